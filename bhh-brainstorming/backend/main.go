@@ -1,14 +1,23 @@
 package main
 
 import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/rs/cors"
 
 	"bhh-brainstorming/backend/handlers"
+	"bhh-brainstorming/backend/models"
 	"bhh-brainstorming/backend/services"
 	"bhh-brainstorming/backend/websocket"
 )
@@ -19,19 +28,106 @@ func main() {
 		log.Println("Warning: Error loading .env file:", err)
 	}
 
-	
-	openAIKey := os.Getenv("OPENAI_API_KEY")
-	if openAIKey == "" {
-		log.Println("Warning: OPENAI_API_KEY environment variable not set. Media aggregation will not work.")
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		runReplay(os.Args[2:])
+		return
 	}
 
 	
-	openAIService := services.NewOpenAIService(openAIKey)
-	mediaProcessor := services.NewMediaProcessor(openAIService)
+	provider, err := newLLMProvider()
+	if err != nil {
+		log.Fatal("Failed to configure LLM provider:", err)
+	}
+	prices, err := priceTable()
+	if err != nil {
+		log.Fatal("Failed to load LLM_PRICE_TABLE:", err)
+	}
+	// The store is attached once it is open below
+	usageMeter := services.NewUsageMeter(nil, prices)
+	provider = services.NewMeteredProvider(provider, usageMeter)
+	transcriber, err := newTranscriber()
+	if err != nil {
+		log.Fatal("Failed to configure transcriber:", err)
+	}
+	mediaProcessor := services.NewMediaProcessor(provider, transcriber)
+	embedder, err := newEmbedder()
+	if err != nil {
+		log.Fatal("Failed to configure embedder:", err)
+	}
+	ideaIndex := services.NewIdeaIndex(services.NewMeteredEmbedder(embedder, usageMeter))
+	mediaProcessor.Images.MaxDimension, err = imageMaxDimension()
+	if err != nil {
+		log.Fatal("Invalid IMAGE_MAX_DIMENSION:", err)
+	}
+	mediaProcessor.MediaWorkers, err = envCount("MEDIA_WORKERS", services.DefaultMediaWorkers)
+	if err != nil {
+		log.Fatal("Invalid MEDIA_WORKERS:", err)
+	}
+	mediaProcessor.MediaRetries, err = envCount("MEDIA_RETRIES", services.DefaultMediaRetries)
+	if err != nil {
+		log.Fatal("Invalid MEDIA_RETRIES:", err)
+	}
+	// 0 keeps the defaults for either limit
+	mediaProcessor.BatchTokenLimit, err = envCount("AGGREGATION_BATCH_TOKENS", services.DefaultBatchTokenLimit)
+	if err != nil {
+		log.Fatal("Invalid AGGREGATION_BATCH_TOKENS:", err)
+	}
+	mediaProcessor.MaxParallel, err = envCount("AGGREGATION_MAX_PARALLEL", services.DefaultMaxParallel)
+	if err != nil {
+		log.Fatal("Invalid AGGREGATION_MAX_PARALLEL:", err)
+	}
+	mediaProcessor.Prompts, err = services.LoadPromptLibrary(os.Getenv("PROMPT_DIR"))
+	if err != nil {
+		log.Fatal("Failed to load prompt templates:", err)
+	}
+	if model := os.Getenv("MEDIA_MODEL"); model != "" {
+		mediaProcessor.MediaModel = model
+	}
+	if model := os.Getenv("AGGREGATION_MODEL"); model != "" {
+		mediaProcessor.AggregationModel = model
+	}
+	mediaProcessor.Models = sessionModels(mediaProcessor)
+	if !mediaProcessor.Video.Available() {
+		log.Println("Warning: ffmpeg not found on PATH. Video ideas will be transcribed without keyframe analysis.")
+	}
 
 	
-	hub := websocket.NewHub()
+	store, err := openSessionStore()
+	if err != nil {
+		log.Fatal("Failed to open session store:", err)
+	}
+	defer store.Close()
+	mediaProcessor.Cache.Store = store
+	ideaIndex.Store = store
+	usageMeter.Store = store
+
+	sessionManager := models.NewSessionManagerWithStore(store)
+	if err := sessionManager.Load(); err != nil {
+		log.Fatal("Failed to load sessions:", err)
+	}
+	log.Printf("Loaded %d sessions from store", len(sessionManager.ListSessions()))
+
+	events, err := models.ReadJournal(journalPath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Fatal("Failed to read journal:", err)
+	}
+	replayed, err := sessionManager.Replay(events)
+	if err != nil {
+		log.Fatal("Failed to replay journal:", err)
+	}
+	log.Printf("Replayed %d of %d journal events", replayed, len(events))
+
+	journal, err := models.OpenJournal(journalPath())
+	if err != nil {
+		log.Fatal("Failed to open journal:", err)
+	}
+	defer journal.Close()
+
+	hub := websocket.NewHub(sessionManager)
+	hub.SetJournal(journal)
 	hub.SetMediaProcessor(mediaProcessor)
+	hub.SetUsageMeter(usageMeter)
+	hub.SetIdeaIndex(ideaIndex)
 	go hub.Run()
 
 	
@@ -51,6 +147,8 @@ func main() {
 	
 	mux.Handle("/media/", http.StripPrefix("/media/", http.FileServer(http.Dir("./media"))))
 	mux.HandleFunc("/api/upload", handlers.UploadMediaHandler)
+	mux.HandleFunc("/api/usage", usageHandler(usageMeter, os.Getenv("USAGE_API_TOKEN")))
+	mux.HandleFunc("/api/prompts", promptsHandler(mediaProcessor))
 
 	
 	corsMiddleware := cors.New(cors.Options{
@@ -74,3 +172,252 @@ func main() {
 		log.Fatal("Server error:", err)
 	}
 }
+
+// openSessionStore picks the session store from SESSION_STORE ("sqlite" by
+// default, or "memory"). The SQLite file lives at SESSION_DB_PATH.
+func openSessionStore() (models.SessionStore, error) {
+	switch os.Getenv("SESSION_STORE") {
+	case "memory":
+		log.Println("Using in-memory session store; sessions will not survive a restart")
+		return models.NewMemoryStore(), nil
+	case "", "sqlite":
+		path := os.Getenv("SESSION_DB_PATH")
+		if path == "" {
+			path = "./data/sessions.db"
+		}
+		log.Println("Using SQLite session store at", path)
+		return models.NewSQLiteStore(path)
+	default:
+		return nil, fmt.Errorf("unknown SESSION_STORE %q", os.Getenv("SESSION_STORE"))
+	}
+}
+
+// newLLMProvider picks the model backend from LLM_PROVIDER: "openai" (the
+// default), "openai-compatible" for any server speaking the OpenAI HTTP API
+// at LLM_BASE_URL, or "fake" for deterministic offline replies.
+func newLLMProvider() (services.LLMProvider, error) {
+	apiKey := os.Getenv("LLM_API_KEY")
+	if apiKey == "" {
+		apiKey = os.Getenv("OPENAI_API_KEY")
+	}
+
+	switch os.Getenv("LLM_PROVIDER") {
+	case "", "openai":
+		if apiKey == "" {
+			log.Println("Warning: OPENAI_API_KEY environment variable not set. Media aggregation will not work.")
+		}
+		return services.NewOpenAIService(apiKey), nil
+	case "openai-compatible":
+		baseURL := os.Getenv("LLM_BASE_URL")
+		if baseURL == "" {
+			return nil, errors.New("LLM_BASE_URL is required for the openai-compatible provider")
+		}
+		log.Println("Using OpenAI-compatible LLM provider at", baseURL)
+		return services.NewOpenAICompatibleProvider(baseURL, apiKey, os.Getenv("LLM_MODEL")), nil
+	case "fake":
+		log.Println("Using fake LLM provider; aggregation results are placeholders")
+		return services.NewFakeProvider(), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM_PROVIDER %q", os.Getenv("LLM_PROVIDER"))
+	}
+}
+
+// newTranscriber picks the speech-to-text backend from TRANSCRIBER: "whisper"
+// or "stub" for offline placeholders. It defaults to the stub when the fake
+// LLM provider is in use and to Whisper otherwise.
+func newTranscriber() (services.Transcriber, error) {
+	kind := os.Getenv("TRANSCRIBER")
+	if kind == "" && os.Getenv("LLM_PROVIDER") == "fake" {
+		kind = "stub"
+	}
+
+	switch kind {
+	case "", "whisper":
+		apiKey := os.Getenv("OPENAI_API_KEY")
+		if apiKey == "" {
+			log.Println("Warning: OPENAI_API_KEY environment variable not set. Audio transcription will not work.")
+		}
+		return services.NewWhisperTranscriber(apiKey), nil
+	case "stub":
+		log.Println("Using stub transcriber; audio transcripts are placeholders")
+		return services.NewStubTranscriber(), nil
+	default:
+		return nil, fmt.Errorf("unknown TRANSCRIBER %q", kind)
+	}
+}
+
+// newEmbedder picks how ideas are embedded from EMBEDDER: "openai", or
+// "hashing" for the offline embedder. Without OPENAI_API_KEY, or with a
+// provider other than OpenAI, the offline one is the default.
+func newEmbedder() (services.Embedder, error) {
+	kind := os.Getenv("EMBEDDER")
+	if kind == "" {
+		provider := os.Getenv("LLM_PROVIDER")
+		if (provider != "" && provider != "openai") || os.Getenv("OPENAI_API_KEY") == "" {
+			kind = "hashing"
+		}
+	}
+
+	switch kind {
+	case "", "openai":
+		embedder := services.NewOpenAIEmbedder(os.Getenv("OPENAI_API_KEY"))
+		if model := os.Getenv("EMBEDDING_MODEL"); model != "" {
+			embedder.Model = model
+		}
+		return embedder, nil
+	case "hashing":
+		log.Println("Using offline hashing embedder; duplicates are found by shared wording only")
+		return services.NewHashingEmbedder(), nil
+	default:
+		return nil, fmt.Errorf("unknown EMBEDDER %q", kind)
+	}
+}
+
+// imageMaxDimension reads IMAGE_MAX_DIMENSION, the longest side in pixels
+// images are scaled down to before being sent to the model. 0 disables it.
+func imageMaxDimension() (int, error) {
+	return envCount("IMAGE_MAX_DIMENSION", services.DefaultImageMaxDimension)
+}
+
+// priceTable reads model prices from the JSON file named by LLM_PRICE_TABLE,
+// falling back to the built-in OpenAI prices.
+func priceTable() (services.PriceTable, error) {
+	path := os.Getenv("LLM_PRICE_TABLE")
+	if path == "" {
+		return services.DefaultPrices, nil
+	}
+	return services.LoadPriceTable(path)
+}
+
+// usageHandler reports token usage and cost, for one session when the
+// sessionId query parameter is given and for every session otherwise. It
+// covers every session, so it is only served to requests bearing token
+// and not at all without one; facilitators see their own session's usage
+// over the socket.
+func usageHandler(meter *services.UsageMeter, token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		reports, err := meter.Reports(r.URL.Query().Get("sessionId"))
+		if err != nil {
+			log.Println("Error loading usage:", err)
+			http.Error(w, "Could not load usage", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reports)
+	}
+}
+
+// sessionModels reads the comma-separated models sessions may pick from
+// LLM_MODELS. The default aggregation model is always allowed.
+func sessionModels(mediaProcessor *services.MediaProcessor) []string {
+	list := os.Getenv("LLM_MODELS")
+	if list == "" {
+		list = mediaProcessor.MediaModel
+	}
+	models := []string{mediaProcessor.AggregationModel}
+	for _, model := range strings.Split(list, ",") {
+		model = strings.TrimSpace(model)
+		if model != "" && !slices.Contains(models, model) {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// promptsHandler lists the prompt templates and models sessions can be
+// created with.
+func promptsHandler(mediaProcessor *services.MediaProcessor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"templates":       mediaProcessor.Prompts.List(),
+			"defaultTemplate": services.DefaultPromptTemplate,
+			"models":          mediaProcessor.Models,
+			"defaultModel":    mediaProcessor.AggregationModel,
+		})
+	}
+}
+
+// envCount reads a non-negative integer from the environment variable name,
+// or returns fallback when it is not set.
+func envCount(name string, fallback int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if count < 0 {
+		return 0, fmt.Errorf("%d is negative", count)
+	}
+	return count, nil
+}
+
+// journalPath is where accepted hub changes are appended, from JOURNAL_PATH.
+func journalPath() string {
+	if path := os.Getenv("JOURNAL_PATH"); path != "" {
+		return path
+	}
+	return "./data/journal.jsonl"
+}
+
+// runReplay re-applies one session's journaled events to an empty session
+// manager and prints the timeline with the resulting state after each step.
+//
+//	go run main.go replay <sessionID>
+func runReplay(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: replay <sessionID>")
+		os.Exit(2)
+	}
+	sessionID := args[0]
+
+	events, err := models.ReadJournal(journalPath())
+	if err != nil {
+		log.Fatal("Failed to read journal:", err)
+	}
+	events = models.SessionEvents(events, sessionID)
+	if len(events) == 0 {
+		log.Fatalf("No journal events for session %s", sessionID)
+	}
+
+	sessionManager := models.NewSessionManager()
+	for _, event := range events {
+		if _, err := sessionManager.Apply(event); err != nil {
+			fmt.Printf("#%d %s %s user=%s ERROR: %v\n", event.Seq, event.Time.Format(time.RFC3339), event.Type, event.UserID, err)
+			continue
+		}
+		state := "session removed"
+		if session, err := sessionManager.GetSession(sessionID); err == nil {
+			state = fmt.Sprintf("users=%d ideas=%d", len(session.GetUsers()), len(session.Ideas))
+		}
+		fmt.Printf("#%d %s %s user=%s %s\n", event.Seq, event.Time.Format(time.RFC3339), event.Type, event.UserID, state)
+		if len(event.Data) > 0 {
+			fmt.Printf("    %s\n", event.Data)
+		}
+	}
+
+	if session, err := sessionManager.GetSession(sessionID); err == nil {
+		final, _ := json.MarshalIndent(session, "", "  ")
+		fmt.Printf("Final state:\n%s\n", final)
+	}
+}
@@ -0,0 +1,131 @@
+// File: backend/models/aggregation.go
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Aggregation is the structured summary of a session's ideas.
+type Aggregation struct {
+	ID             string    `json:"id,omitempty"`
+	Summary        string    `json:"summary"`
+	Themes         []Theme   `json:"themes"`
+	OpenQuestions  []string  `json:"openQuestions"`
+	ActionItems    []string  `json:"actionItems"`
+	Model          string    `json:"model,omitempty"`
+	PromptTemplate string    `json:"promptTemplate,omitempty"`
+	PromptVersion  string    `json:"promptVersion,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+	// IdeaIDs are the ideas the aggregation was built from.
+	IdeaIDs []string `json:"ideaIds,omitempty"`
+	// FailedIdeas could not be processed and were left out of the summary.
+	FailedIdeas []FailedIdea `json:"failedIdeas,omitempty"`
+	// Sections summarize the ideas by the guiding question they answer.
+	Sections []QuestionSection `json:"sections,omitempty"`
+	// Suggestions propose guiding questions for untagged ideas.
+	Suggestions []QuestionSuggestion `json:"suggestions,omitempty"`
+}
+
+// FailedIdea records why an idea was skipped during aggregation.
+type FailedIdea struct {
+	IdeaID string `json:"ideaId"`
+	Error  string `json:"error"`
+}
+
+// Theme groups related ideas, referenced by ID.
+type Theme struct {
+	Title   string   `json:"title"`
+	Summary string   `json:"summary"`
+	IdeaIDs []string `json:"ideaIds"`
+	Pros    []string `json:"pros"`
+	Cons    []string `json:"cons"`
+}
+
+// ParseAggregation decodes a model's JSON reply and validates it against the
+// ideas that were sent for aggregation.
+func ParseAggregation(raw string, ideaIDs []string) (*Aggregation, error) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	decoder.DisallowUnknownFields()
+	var aggregation Aggregation
+	if err := decoder.Decode(&aggregation); err != nil {
+		return nil, fmt.Errorf("aggregation is not valid JSON: %w", err)
+	}
+	if err := aggregation.Validate(ideaIDs); err != nil {
+		return nil, err
+	}
+	return &aggregation, nil
+}
+
+// Validate checks that every theme has a title and only links to known
+// ideas. Missing lists are normalized to empty ones and repeated idea IDs
+// within a theme are dropped.
+func (a *Aggregation) Validate(ideaIDs []string) error {
+	known := make(map[string]bool, len(ideaIDs))
+	for _, id := range ideaIDs {
+		known[id] = true
+	}
+
+	a.Summary = strings.TrimSpace(a.Summary)
+	if a.Summary == "" {
+		return errors.New("aggregation summary is empty")
+	}
+	if a.Themes == nil {
+		a.Themes = []Theme{}
+	}
+	for i := range a.Themes {
+		theme := &a.Themes[i]
+		theme.Title = strings.TrimSpace(theme.Title)
+		if theme.Title == "" {
+			return fmt.Errorf("theme %d has no title", i+1)
+		}
+		seen := map[string]bool{}
+		ids := []string{}
+		for _, id := range theme.IdeaIDs {
+			if !known[id] {
+				return fmt.Errorf("theme %q references unknown idea %q", theme.Title, id)
+			}
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		theme.IdeaIDs = ids
+		theme.Pros = nonNil(theme.Pros)
+		theme.Cons = nonNil(theme.Cons)
+	}
+	a.OpenQuestions = nonNil(a.OpenQuestions)
+	a.ActionItems = nonNil(a.ActionItems)
+
+	suggested := map[string]bool{}
+	suggestions := []QuestionSuggestion{}
+	for _, suggestion := range a.Suggestions {
+		if !known[suggestion.IdeaID] {
+			return fmt.Errorf("suggestion references unknown idea %q", suggestion.IdeaID)
+		}
+		if !suggested[suggestion.IdeaID] {
+			suggested[suggestion.IdeaID] = true
+			suggestions = append(suggestions, suggestion)
+		}
+	}
+	a.Suggestions = suggestions
+	return nil
+}
+
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
+
+// GetAggregation returns the session's latest aggregation, if any.
+func (s *Session) GetAggregation() *Aggregation {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.Aggregation
+}
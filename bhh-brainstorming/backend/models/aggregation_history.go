@@ -0,0 +1,244 @@
+// File: backend/models/aggregation_history.go
+package models
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AddAggregation records a finished aggregation as the latest one and
+// appends it to the history. Adding an aggregation that is already in the
+// history only makes it the latest again, so replaying is safe.
+func (s *Session) AddAggregation(aggregation *Aggregation) {
+	aggregation.ensureID()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Aggregation = aggregation
+	for _, previous := range s.AggregationHistory {
+		if previous.ID == aggregation.ID {
+			return
+		}
+	}
+	s.AggregationHistory = append(s.AggregationHistory, aggregation)
+}
+
+// GetAggregationHistory returns the session's aggregations, oldest first.
+func (s *Session) GetAggregationHistory() []*Aggregation {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	history := make([]*Aggregation, len(s.AggregationHistory))
+	copy(history, s.AggregationHistory)
+	return history
+}
+
+// FindAggregation looks up an aggregation in the history by ID.
+func (s *Session) FindAggregation(id string) (*Aggregation, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, aggregation := range s.AggregationHistory {
+		if aggregation.ID == id {
+			return aggregation, true
+		}
+	}
+	return nil, false
+}
+
+// ensureID gives aggregations from before they had IDs one derived from
+// their creation time.
+func (a *Aggregation) ensureID() {
+	if a.ID == "" {
+		a.ID = strconv.FormatInt(a.CreatedAt.UnixNano(), 10)
+	}
+}
+
+// AggregationDiff lists what changed from one aggregation to a later one.
+// Themes are matched by title, or failing that by the ideas they share.
+type AggregationDiff struct {
+	From                 string        `json:"from"`
+	To                   string        `json:"to"`
+	AddedThemes          []Theme       `json:"addedThemes"`
+	RemovedThemes        []Theme       `json:"removedThemes"`
+	ChangedThemes        []ThemeChange `json:"changedThemes"`
+	AddedIdeaIDs         []string      `json:"addedIdeaIds"`
+	RemovedIdeaIDs       []string      `json:"removedIdeaIds"`
+	AddedOpenQuestions   []string      `json:"addedOpenQuestions"`
+	RemovedOpenQuestions []string      `json:"removedOpenQuestions"`
+	AddedActionItems     []string      `json:"addedActionItems"`
+	RemovedActionItems   []string      `json:"removedActionItems"`
+	SummaryChanged       bool          `json:"summaryChanged"`
+}
+
+// ThemeChange describes a theme present in both aggregations that differs
+// between them. PreviousTitle is set when the theme was renamed.
+type ThemeChange struct {
+	Title          string   `json:"title"`
+	PreviousTitle  string   `json:"previousTitle,omitempty"`
+	SummaryChanged bool     `json:"summaryChanged"`
+	AddedIdeaIDs   []string `json:"addedIdeaIds"`
+	RemovedIdeaIDs []string `json:"removedIdeaIds"`
+	AddedPros      []string `json:"addedPros"`
+	RemovedPros    []string `json:"removedPros"`
+	AddedCons      []string `json:"addedCons"`
+	RemovedCons    []string `json:"removedCons"`
+}
+
+// minThemeOverlap is the share of ideas two differently titled themes must
+// have in common to count as the same theme.
+const minThemeOverlap = 0.5
+
+// DiffAggregations compares two aggregations of the same session.
+func DiffAggregations(from *Aggregation, to *Aggregation) AggregationDiff {
+	diff := AggregationDiff{
+		From:           from.ID,
+		To:             to.ID,
+		AddedThemes:    []Theme{},
+		RemovedThemes:  []Theme{},
+		ChangedThemes:  []ThemeChange{},
+		SummaryChanged: strings.TrimSpace(from.Summary) != strings.TrimSpace(to.Summary),
+	}
+	diff.AddedIdeaIDs, diff.RemovedIdeaIDs = diffLists(coveredIdeas(from), coveredIdeas(to))
+	diff.AddedOpenQuestions, diff.RemovedOpenQuestions = diffLists(from.OpenQuestions, to.OpenQuestions)
+	diff.AddedActionItems, diff.RemovedActionItems = diffLists(from.ActionItems, to.ActionItems)
+
+	// matched maps each theme of to, by index, to its counterpart in from
+	matched := map[int]int{}
+	used := map[int]bool{}
+	for j, theme := range to.Themes {
+		for i, previous := range from.Themes {
+			if !used[i] && normalizeTitle(previous.Title) == normalizeTitle(theme.Title) {
+				matched[j] = i
+				used[i] = true
+				break
+			}
+		}
+	}
+	for j, theme := range to.Themes {
+		if _, ok := matched[j]; ok {
+			continue
+		}
+		best, bestOverlap := -1, 0.0
+		for i, previous := range from.Themes {
+			if used[i] {
+				continue
+			}
+			if overlap := ideaOverlap(previous.IdeaIDs, theme.IdeaIDs); overlap > bestOverlap {
+				best, bestOverlap = i, overlap
+			}
+		}
+		if best >= 0 && bestOverlap >= minThemeOverlap {
+			matched[j] = best
+			used[best] = true
+		}
+	}
+
+	for j, theme := range to.Themes {
+		i, ok := matched[j]
+		if !ok {
+			diff.AddedThemes = append(diff.AddedThemes, theme)
+			continue
+		}
+		if change, changed := diffTheme(from.Themes[i], theme); changed {
+			diff.ChangedThemes = append(diff.ChangedThemes, change)
+		}
+	}
+	for i, previous := range from.Themes {
+		if !used[i] {
+			diff.RemovedThemes = append(diff.RemovedThemes, previous)
+		}
+	}
+	return diff
+}
+
+func diffTheme(from Theme, to Theme) (ThemeChange, bool) {
+	change := ThemeChange{
+		Title:          to.Title,
+		SummaryChanged: strings.TrimSpace(from.Summary) != strings.TrimSpace(to.Summary),
+	}
+	if from.Title != to.Title {
+		change.PreviousTitle = from.Title
+	}
+	change.AddedIdeaIDs, change.RemovedIdeaIDs = diffLists(from.IdeaIDs, to.IdeaIDs)
+	change.AddedPros, change.RemovedPros = diffLists(from.Pros, to.Pros)
+	change.AddedCons, change.RemovedCons = diffLists(from.Cons, to.Cons)
+
+	changed := change.PreviousTitle != "" || change.SummaryChanged ||
+		len(change.AddedIdeaIDs) > 0 || len(change.RemovedIdeaIDs) > 0 ||
+		len(change.AddedPros) > 0 || len(change.RemovedPros) > 0 ||
+		len(change.AddedCons) > 0 || len(change.RemovedCons) > 0
+	return change, changed
+}
+
+// diffLists returns the entries only in to and only in from, keeping
+// their order.
+func diffLists(from []string, to []string) (added []string, removed []string) {
+	inFrom := make(map[string]bool, len(from))
+	for _, entry := range from {
+		inFrom[entry] = true
+	}
+	inTo := make(map[string]bool, len(to))
+	for _, entry := range to {
+		inTo[entry] = true
+	}
+	added, removed = []string{}, []string{}
+	for _, entry := range to {
+		if !inFrom[entry] {
+			added = append(added, entry)
+		}
+	}
+	for _, entry := range from {
+		if !inTo[entry] {
+			removed = append(removed, entry)
+		}
+	}
+	return added, removed
+}
+
+// coveredIdeas returns the ideas an aggregation was built from. Older
+// aggregations did not record them, so their themes stand in.
+func coveredIdeas(aggregation *Aggregation) []string {
+	if aggregation.IdeaIDs != nil {
+		return aggregation.IdeaIDs
+	}
+	seen := map[string]bool{}
+	for _, theme := range aggregation.Themes {
+		for _, id := range theme.IdeaIDs {
+			seen[id] = true
+		}
+	}
+	ids := make([]string, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// ideaOverlap is the Jaccard similarity of two lists of idea IDs.
+func ideaOverlap(a []string, b []string) float64 {
+	inA := make(map[string]bool, len(a))
+	for _, id := range a {
+		inA[id] = true
+	}
+	shared, union := 0, len(inA)
+	seen := map[string]bool{}
+	for _, id := range b {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if inA[id] {
+			shared++
+		} else {
+			union++
+		}
+	}
+	if union == 0 {
+		return 0
+	}
+	return float64(shared) / float64(union)
+}
+
+func normalizeTitle(title string) string {
+	return strings.ToLower(strings.Join(strings.Fields(title), " "))
+}
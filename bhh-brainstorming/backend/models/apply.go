@@ -0,0 +1,253 @@
+// File: backend/models/apply.go
+package models
+
+import (
+	"errors"
+	"log"
+)
+
+// Replay applies events in journal order and saves each touched session
+// once at the end, returning how many events it applied. A session's Seq
+// is its checkpoint: events it already holds are skipped, so only what
+// happened after the session was last saved is applied, and the history of
+// sessions removed since is skipped as a whole. Events for sessions that no
+// longer exist, or that cannot be applied, are logged and skipped rather
+// than keeping the server from starting.
+func (sm *SessionManager) Replay(events []Event) (int, error) {
+	removedAt := map[string]int{}
+	for i, event := range events {
+		if event.Type == EventSessionRemoved {
+			removedAt[event.SessionID] = i
+		}
+	}
+	touched := map[string]bool{}
+	applied := 0
+	for i, event := range events {
+		if last, removed := removedAt[event.SessionID]; removed && i <= last {
+			// Only the removal itself may still be missing from the store
+			if _, err := sm.GetSession(event.SessionID); i < last || err != nil {
+				continue
+			}
+		}
+		if event.SessionSeq != 0 {
+			if session, err := sm.GetSession(event.SessionID); err == nil && event.SessionSeq <= session.GetSeq() {
+				continue
+			}
+		}
+		session, err := sm.Apply(event)
+		if errors.Is(err, ErrSessionNotFound) {
+			log.Printf("Skipping journal event %d (%s): session %s not found", event.Seq, event.Type, event.SessionID)
+			continue
+		}
+		if err != nil {
+			log.Printf("Skipping journal event %d (%s) of session %s: %v", event.Seq, event.Type, event.SessionID, err)
+			continue
+		}
+		applied++
+		if session != nil || event.Type == EventSessionRemoved {
+			touched[event.SessionID] = true
+		}
+	}
+	for sessionID := range touched {
+		session, err := sm.GetSession(sessionID)
+		if err != nil {
+			if err := sm.store.DeleteSession(sessionID); err != nil {
+				return applied, err
+			}
+			continue
+		}
+		if err := sm.store.SaveSession(session); err != nil {
+			return applied, err
+		}
+	}
+	return applied, nil
+}
+
+// Apply updates in-memory session state for a journaled event and returns
+// the session that changed, or nil when the event is purely informational
+// and carries no sequence number. Applying an event whose effect is
+// already present is a no-op, so the journal can be replayed on top of
+// sessions loaded from the store. Callers are responsible for saving the
+// returned session.
+func (sm *SessionManager) Apply(event Event) (*Session, error) {
+	session, err := sm.apply(event)
+	if err != nil || event.SessionSeq == 0 || event.Type == EventSessionRemoved {
+		return session, err
+	}
+	// Informational events move the sequence number on as well
+	current, err := sm.GetSession(event.SessionID)
+	if err != nil {
+		return session, nil
+	}
+	if current.advanceSeq(event.SessionSeq) {
+		return current, nil
+	}
+	return session, nil
+}
+
+func (sm *SessionManager) apply(event Event) (*Session, error) {
+	switch event.Type {
+	case EventSessionCreated:
+		var data SessionCreatedData
+		if err := event.Decode(&data); err != nil {
+			return nil, err
+		}
+		sm.mutex.Lock()
+		defer sm.mutex.Unlock()
+		if session, exists := sm.sessions[event.SessionID]; exists {
+			return session, nil
+		}
+		session := NewSession(event.SessionID, data.Name, data.GuidingQuestions, data.Creator)
+		session.CreatedAt = data.CreatedAt
+		session.PromptTemplate = data.PromptTemplate
+		session.Model = data.Model
+		sm.sessions[event.SessionID] = session
+		return session, nil
+
+	case EventSessionRemoved:
+		sm.mutex.Lock()
+		defer sm.mutex.Unlock()
+		delete(sm.sessions, event.SessionID)
+		return nil, nil
+	}
+
+	session, err := sm.GetSession(event.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch event.Type {
+	case EventUserJoined:
+		var data UserJoinedData
+		if err := event.Decode(&data); err != nil {
+			return nil, err
+		}
+		session.AddUser(data.User)
+		if data.Role != "" {
+			session.SetRole(data.User.ID, data.Role)
+		}
+		return session, nil
+
+	case EventUserLeft:
+		session.RemoveUser(event.UserID)
+		return session, nil
+
+	case EventUserKicked:
+		var data UserKickedData
+		if err := event.Decode(&data); err != nil {
+			return nil, err
+		}
+		session.RemoveUser(data.UserID)
+		session.Ban(data.UserID)
+		return session, nil
+
+	case EventRoleChanged:
+		var data RoleChangedData
+		if err := event.Decode(&data); err != nil {
+			return nil, err
+		}
+		session.SetRole(data.UserID, data.Role)
+		return session, nil
+
+	case EventIdeaSubmitted:
+		var data IdeaSubmittedData
+		if err := event.Decode(&data); err != nil {
+			return nil, err
+		}
+		if _, exists := session.GetIdea(data.Idea.ID); !exists {
+			idea := data.Idea
+			session.AddIdea(&idea)
+		}
+		return session, nil
+
+	case EventIdeaRated:
+		var data IdeaRatedData
+		if err := event.Decode(&data); err != nil {
+			return nil, err
+		}
+		if err := session.RateIdea(data.IdeaID, data.Rating); err != nil {
+			return nil, err
+		}
+		return session, nil
+
+	case EventIdeaTranscribed:
+		var data IdeaTranscribedData
+		if err := event.Decode(&data); err != nil {
+			return nil, err
+		}
+		if err := session.SetTranscript(data.IdeaID, data.Transcript); err != nil {
+			return nil, err
+		}
+		return session, nil
+
+	case EventIdeaDescribed:
+		var data IdeaDescribedData
+		if err := event.Decode(&data); err != nil {
+			return nil, err
+		}
+		if err := session.SetDescription(data.IdeaID, data.Description, data.MediaMeta); err != nil {
+			return nil, err
+		}
+		return session, nil
+
+	case EventIdeaTagged:
+		var data IdeaTaggedData
+		if err := event.Decode(&data); err != nil {
+			return nil, err
+		}
+		if err := session.TagIdea(data.IdeaID, data.GuidingQuestion); err != nil {
+			return nil, err
+		}
+		return session, nil
+
+	case EventIdeasClustered:
+		var data IdeasClusteredData
+		if err := event.Decode(&data); err != nil {
+			return nil, err
+		}
+		session.SetClustering(&data.Clustering)
+		return session, nil
+
+	case EventPhaseChanged:
+		var data PhaseChangedData
+		if err := event.Decode(&data); err != nil {
+			return nil, err
+		}
+		session.SetPhase(data.To)
+		return session, nil
+
+	case EventBudgetChanged:
+		var data BudgetChangedData
+		if err := event.Decode(&data); err != nil {
+			return nil, err
+		}
+		session.SetBudget(data.Budget)
+		return session, nil
+
+	case EventNudgesToggled:
+		var data NudgesToggledData
+		if err := event.Decode(&data); err != nil {
+			return nil, err
+		}
+		session.SetNudgesEnabled(data.Enabled)
+		return session, nil
+
+	case EventAggregationCompleted:
+		var data AggregationCompletedData
+		if err := event.Decode(&data); err != nil {
+			return nil, err
+		}
+		if data.Aggregation == nil {
+			return nil, nil
+		}
+		if data.Aggregation.ID == "" {
+			data.Aggregation.ID = data.JobID
+		}
+		session.AddAggregation(data.Aggregation)
+		return session, nil
+	}
+
+	// Chat messages and other aggregation events are journaled for auditing
+	// but do not change session state.
+	return nil, nil
+}
@@ -0,0 +1,94 @@
+// File: backend/models/apply_test.go
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func journalEvent(t *testing.T, seq int64, eventType string, sessionID string, data interface{}) Event {
+	t.Helper()
+	event, err := NewEvent(eventType, sessionID, "alice", data)
+	if err != nil {
+		t.Fatalf("NewEvent(%s): %v", eventType, err)
+	}
+	event.Seq = seq
+	event.SessionSeq = seq
+	return event
+}
+
+func TestReplaySkipsEventsThatFailToApply(t *testing.T) {
+	sm := NewSessionManager()
+	events := []Event{
+		journalEvent(t, 1, EventSessionCreated, "S1", SessionCreatedData{
+			Name:      "Roof",
+			Creator:   User{ID: "alice", Username: "alice"},
+			CreatedAt: time.Now(),
+		}),
+		// Rates an idea that was never submitted
+		journalEvent(t, 2, EventIdeaRated, "S1", IdeaRatedData{IdeaID: "missing"}),
+		journalEvent(t, 3, EventIdeaSubmitted, "S1", IdeaSubmittedData{Idea: Idea{ID: "I1", Content: "Plant trees"}}),
+	}
+	applied, err := sm.Replay(events)
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if applied != 2 {
+		t.Fatalf("Replay applied %d events, want 2", applied)
+	}
+	session, err := sm.GetSession("S1")
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if _, ok := session.GetIdea("I1"); !ok {
+		t.Fatalf("the idea submitted after the failing event is missing")
+	}
+}
+
+func TestReplayStartsAfterCheckpoint(t *testing.T) {
+	sm := NewSessionManager()
+	created := journalEvent(t, 1, EventSessionCreated, "S1", SessionCreatedData{
+		Name:      "Roof",
+		Creator:   User{ID: "alice", Username: "alice"},
+		CreatedAt: time.Now(),
+	})
+	submitted := journalEvent(t, 2, EventIdeaSubmitted, "S1", IdeaSubmittedData{Idea: Idea{ID: "I1", Content: "Plant trees"}})
+	if _, err := sm.Replay([]Event{created, submitted}); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+
+	// A restart replays the whole journal on top of the saved sessions
+	restarted := NewSessionManagerWithStore(sm.store)
+	if err := restarted.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	later := journalEvent(t, 3, EventIdeaSubmitted, "S1", IdeaSubmittedData{Idea: Idea{ID: "I2", Content: "Share bikes"}})
+	applied, err := restarted.Replay([]Event{created, submitted, later})
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if applied != 1 {
+		t.Fatalf("Replay applied %d events, want only the one after the checkpoint", applied)
+	}
+}
+
+func TestReplaySkipsRemovedSessions(t *testing.T) {
+	sm := NewSessionManager()
+	applied, err := sm.Replay([]Event{
+		journalEvent(t, 1, EventSessionCreated, "S1", SessionCreatedData{
+			Name:      "Roof",
+			Creator:   User{ID: "alice", Username: "alice"},
+			CreatedAt: time.Now(),
+		}),
+		journalEvent(t, 2, EventSessionRemoved, "S1", nil),
+	})
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if applied != 0 {
+		t.Fatalf("Replay applied %d events of a removed session, want 0", applied)
+	}
+	if _, err := sm.GetSession("S1"); err == nil {
+		t.Fatalf("removed session came back")
+	}
+}
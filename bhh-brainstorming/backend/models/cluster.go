@@ -0,0 +1,44 @@
+// File: backend/models/cluster.go
+package models
+
+import "time"
+
+// IdeaCluster is a group of ideas that say much the same thing. Label
+// names the terms that set the group apart from the rest of the session.
+type IdeaCluster struct {
+	Label   string   `json:"label"`
+	IdeaIDs []string `json:"ideaIds"`
+}
+
+// IdeaClustering is the result of one cluster_ideas run. Ideas submitted
+// after CreatedAt are in none of the clusters until the next run.
+type IdeaClustering struct {
+	Clusters  []IdeaCluster `json:"clusters"`
+	Model     string        `json:"model"` // embedding model the ideas were compared with
+	CreatedAt time.Time     `json:"createdAt"`
+}
+
+// GetIdeas returns copies of the session's ideas, safe to read while the
+// session keeps changing.
+func (s *Session) GetIdeas() []Idea {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	ideas := make([]Idea, len(s.Ideas))
+	for i, idea := range s.Ideas {
+		ideas[i] = *idea
+	}
+	return ideas
+}
+
+func (s *Session) GetClustering() *IdeaClustering {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.Clustering
+}
+
+// SetClustering replaces the session's clusters with a newer run.
+func (s *Session) SetClustering(clustering *IdeaClustering) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Clustering = clustering
+}
@@ -0,0 +1,169 @@
+// File: backend/models/event.go
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event types written to the journal. Each one corresponds to a client
+// message the hub accepted.
+const (
+	EventSessionCreated       = "session_created"
+	EventUserJoined           = "user_joined"
+	EventUserLeft             = "user_left"
+	EventUserKicked           = "user_kicked"
+	EventRoleChanged          = "role_changed"
+	EventSessionRemoved       = "session_removed"
+	EventSessionMessage       = "session_message"
+	EventIdeaSubmitted        = "idea_submitted"
+	EventIdeaRated            = "idea_rated"
+	EventIdeaTranscribed      = "idea_transcribed"
+	EventIdeaDescribed        = "idea_described"
+	EventAggregationRequested = "aggregation_requested"
+	EventAggregationCompleted = "aggregation_completed"
+	EventAggregationFailed    = "aggregation_failed"
+	EventAggregationCancelled = "aggregation_cancelled"
+	EventPhaseChanged         = "phase_changed"
+	EventBudgetChanged        = "budget_changed"
+	EventIdeaTagged           = "idea_tagged"
+	EventIdeasClustered       = "ideas_clustered"
+	EventNudgesToggled        = "nudges_toggled"
+)
+
+// Event is a single entry in the append-only journal. Data holds one of the
+// *Data payload types below, matching Type.
+type Event struct {
+	Seq int64 `json:"seq"`
+	// SessionSeq numbers the events of one session from 1. Journals from
+	// before it was added leave it at 0.
+	SessionSeq int64           `json:"sessionSeq,omitempty"`
+	Type       string          `json:"type"`
+	SessionID  string          `json:"sessionId"`
+	UserID     string          `json:"userId,omitempty"`
+	Time       time.Time       `json:"time"`
+	Data       json.RawMessage `json:"data,omitempty"`
+}
+
+type SessionCreatedData struct {
+	Name             string    `json:"name"`
+	GuidingQuestions []string  `json:"guidingQuestions"`
+	Creator          User      `json:"creator"`
+	CreatedAt        time.Time `json:"createdAt"`
+	PromptTemplate   string    `json:"promptTemplate,omitempty"`
+	Model            string    `json:"model,omitempty"`
+}
+
+type UserJoinedData struct {
+	User User        `json:"user"`
+	Role SessionRole `json:"role,omitempty"`
+}
+
+type UserKickedData struct {
+	UserID string `json:"userId"`
+}
+
+type RoleChangedData struct {
+	UserID string      `json:"userId"`
+	Role   SessionRole `json:"role"`
+}
+
+type SessionMessageData struct {
+	Username string      `json:"username,omitempty"`
+	Message  interface{} `json:"message"`
+}
+
+type IdeaSubmittedData struct {
+	Idea Idea `json:"idea"`
+}
+
+type IdeaRatedData struct {
+	IdeaID string     `json:"ideaId"`
+	Rating IdeaRating `json:"rating"`
+}
+
+// IdeaTaggedData sets the guiding question an idea answers; 0 removes the
+// tag.
+type IdeaTaggedData struct {
+	IdeaID          string `json:"ideaId"`
+	GuidingQuestion int    `json:"guidingQuestion"`
+}
+
+type IdeasClusteredData struct {
+	Clustering IdeaClustering `json:"clustering"`
+}
+
+type IdeaTranscribedData struct {
+	IdeaID     string `json:"ideaId"`
+	Transcript string `json:"transcript"`
+}
+
+type IdeaDescribedData struct {
+	IdeaID      string      `json:"ideaId"`
+	Description string      `json:"description"`
+	MediaMeta   interface{} `json:"mediaMeta,omitempty"`
+}
+
+// AggregationRequestedData names the job started for the request. Journals
+// from before aggregation jobs have no data for this event.
+type AggregationRequestedData struct {
+	JobID string `json:"jobId"`
+}
+
+// AggregationCompletedData carries the validated aggregation. Content is its
+// plain-text summary, the only field in journals from before aggregations
+// were structured.
+type AggregationCompletedData struct {
+	JobID       string       `json:"jobId,omitempty"`
+	Content     string       `json:"content"`
+	Aggregation *Aggregation `json:"aggregation,omitempty"`
+}
+
+type PhaseChangedData struct {
+	From SessionPhase `json:"from"`
+	To   SessionPhase `json:"to"`
+}
+
+type BudgetChangedData struct {
+	Budget float64 `json:"budget"`
+}
+
+type NudgesToggledData struct {
+	Enabled bool `json:"enabled"`
+}
+
+type AggregationFailedData struct {
+	JobID string `json:"jobId,omitempty"`
+	Error string `json:"error"`
+}
+
+type AggregationCancelledData struct {
+	JobID string `json:"jobId"`
+}
+
+// NewEvent builds an event with its payload encoded. Seq is assigned when
+// the event is appended to a journal.
+func NewEvent(eventType string, sessionID string, userID string, data interface{}) (Event, error) {
+	event := Event{
+		Type:      eventType,
+		SessionID: sessionID,
+		UserID:    userID,
+		Time:      time.Now(),
+	}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return Event{}, err
+		}
+		event.Data = raw
+	}
+	return event, nil
+}
+
+// Decode unmarshals the event payload into v.
+func (e Event) Decode(v interface{}) error {
+	if len(e.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(e.Data, v)
+}
@@ -0,0 +1,78 @@
+// File: backend/models/guiding_question.go
+package models
+
+import "errors"
+
+var ErrInvalidQuestion = errors.New("no such guiding question")
+
+// QuestionSection summarizes the ideas answering one guiding question.
+// Question is the question's number from 1, or 0 for the section of ideas
+// that answer none of them.
+type QuestionSection struct {
+	Question int      `json:"question"`
+	Summary  string   `json:"summary"`
+	IdeaIDs  []string `json:"ideaIds,omitempty"`
+}
+
+// QuestionSuggestion is the model's pick of the guiding question an
+// untagged idea fits best, 0 when it fits none.
+type QuestionSuggestion struct {
+	IdeaID   string `json:"ideaId"`
+	Question int    `json:"question"`
+}
+
+// TagIdea records the guiding question an idea answers; 0 removes the tag.
+func (s *Session) TagIdea(ideaID string, question int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if question < 0 || question > len(s.GuidingQuestions) {
+		return ErrInvalidQuestion
+	}
+	for _, idea := range s.Ideas {
+		if idea.ID == ideaID {
+			idea.GuidingQuestion = question
+			return nil
+		}
+	}
+	return ErrIdeaNotFound
+}
+
+// AssignSections builds one section per guiding question plus the
+// unassigned section, in that order. Tagged ideas go to their question;
+// untagged ones to the question suggested for them, if any. The model's
+// section summaries are kept, and suggestions for tagged ideas or for
+// questions that do not exist are dropped.
+func (a *Aggregation) AssignSections(questions int, tags map[string]int) {
+	summaries := map[int]string{}
+	for _, section := range a.Sections {
+		if _, seen := summaries[section.Question]; !seen && section.Question >= 0 && section.Question <= questions {
+			summaries[section.Question] = section.Summary
+		}
+	}
+
+	suggestions := []QuestionSuggestion{}
+	suggested := map[string]int{}
+	for _, suggestion := range a.Suggestions {
+		if tags[suggestion.IdeaID] != 0 || suggestion.Question < 0 || suggestion.Question > questions {
+			continue
+		}
+		suggestions = append(suggestions, suggestion)
+		suggested[suggestion.IdeaID] = suggestion.Question
+	}
+	a.Suggestions = suggestions
+
+	sections := make([]QuestionSection, questions+1)
+	for i := range sections {
+		question := (i + 1) % (questions + 1) // the unassigned section 0 goes last
+		sections[i] = QuestionSection{Question: question, Summary: summaries[question], IdeaIDs: []string{}}
+	}
+	for _, id := range a.IdeaIDs {
+		question := tags[id]
+		if question == 0 {
+			question = suggested[id]
+		}
+		index := (question + questions) % (questions + 1)
+		sections[index].IdeaIDs = append(sections[index].IdeaIDs, id)
+	}
+	a.Sections = sections
+}
@@ -0,0 +1,122 @@
+// File: backend/models/journal.go
+package models
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Journal is an append-only log of events, one JSON object per line.
+type Journal struct {
+	file    *os.File
+	lastSeq int64
+	mutex   sync.Mutex
+}
+
+// OpenJournal opens (or creates) the journal at path and positions new
+// events after the ones already in the file.
+func OpenJournal(path string) (*Journal, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+	events, size, err := readJournal(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return nil, err
+	}
+	journal := &Journal{file: file}
+	if len(events) > 0 {
+		journal.lastSeq = events[len(events)-1].Seq
+	}
+	return journal, nil
+}
+
+// Append assigns the next sequence number to event and writes it durably.
+func (j *Journal) Append(event *Event) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	event.Seq = j.lastSeq + 1
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if _, err := j.file.Write(line); err != nil {
+		return err
+	}
+	if err := j.file.Sync(); err != nil {
+		return err
+	}
+	j.lastSeq = event.Seq
+	return nil
+}
+
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+// ReadJournal returns every event stored at path in the order written. A
+// torn final line, left behind if the process died mid-write, is skipped.
+func ReadJournal(path string) ([]Event, error) {
+	events, _, err := readJournal(path)
+	return events, err
+}
+
+// readJournal also reports the byte length of the intact prefix of the file
+// so OpenJournal can cut off a torn final line before appending to it.
+func readJournal(path string) ([]Event, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	events := []Event{}
+	var size int64
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				log.Printf("Ignoring incomplete journal entry at end of %s", path)
+			}
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		var event Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			return nil, 0, err
+		}
+		events = append(events, event)
+		size += int64(len(line))
+	}
+	return events, size, nil
+}
+
+// SessionEvents filters events down to those belonging to one session.
+func SessionEvents(events []Event, sessionID string) []Event {
+	filtered := []Event{}
+	for _, event := range events {
+		if event.SessionID == sessionID {
+			filtered = append(filtered, event)
+		}
+	}
+	return filtered
+}
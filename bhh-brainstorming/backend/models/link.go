@@ -0,0 +1,13 @@
+// File: backend/models/link.go
+package models
+
+// LinkMeta is what was extracted from the page behind a link idea. It is
+// stored as the idea's MediaMeta.
+type LinkMeta struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	SiteName    string `json:"siteName,omitempty"`
+	Image       string `json:"image,omitempty"`
+	Text        string `json:"text,omitempty"`
+}
@@ -0,0 +1,16 @@
+// File: backend/models/nudge.go
+package models
+
+// NudgesEnabled reports whether participants may ask the AI for nudges
+// when they are stuck.
+func (s *Session) NudgesEnabled() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return !s.NudgesDisabled
+}
+
+func (s *Session) SetNudgesEnabled(enabled bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.NudgesDisabled = !enabled
+}
@@ -0,0 +1,82 @@
+// File: backend/models/phase.go
+package models
+
+import "fmt"
+
+// SessionPhase is the stage a brainstorm is in. Sessions move forward
+// through collect → rate → discuss → closed and can be closed early.
+type SessionPhase string
+
+const (
+	PhaseCollect SessionPhase = "collect"
+	PhaseRate    SessionPhase = "rate"
+	PhaseDiscuss SessionPhase = "discuss"
+	PhaseClosed  SessionPhase = "closed"
+)
+
+var phaseTransitions = map[SessionPhase][]SessionPhase{
+	PhaseCollect: {PhaseRate, PhaseClosed},
+	PhaseRate:    {PhaseDiscuss, PhaseClosed},
+	PhaseDiscuss: {PhaseClosed},
+}
+
+// Valid reports whether p is one of the known phases.
+func (p SessionPhase) Valid() bool {
+	switch p {
+	case PhaseCollect, PhaseRate, PhaseDiscuss, PhaseClosed:
+		return true
+	}
+	return false
+}
+
+// CheckTransition returns an error unless a session may move from p to next.
+func (p SessionPhase) CheckTransition(next SessionPhase) error {
+	if !next.Valid() {
+		return fmt.Errorf("unknown phase %q", next)
+	}
+	for _, allowed := range phaseTransitions[p] {
+		if allowed == next {
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot move from %s to %s", p, next)
+}
+
+// AllowsIdeas reports whether new ideas are accepted in this phase.
+func (p SessionPhase) AllowsIdeas() bool {
+	return p == PhaseCollect
+}
+
+// AllowsRatings reports whether ideas can be rated in this phase.
+func (p SessionPhase) AllowsRatings() bool {
+	return p == PhaseRate
+}
+
+// AllowsChat reports whether session chat messages are accepted.
+func (p SessionPhase) AllowsChat() bool {
+	return p != PhaseClosed
+}
+
+// AllowsAggregation reports whether ideas can be aggregated in this phase.
+func (p SessionPhase) AllowsAggregation() bool {
+	return p != PhaseClosed
+}
+
+// AllowsTagging reports whether ideas can be tagged with a guiding question.
+func (p SessionPhase) AllowsTagging() bool {
+	return p != PhaseClosed
+}
+
+func (s *Session) GetPhase() SessionPhase {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.Phase
+}
+
+// SetPhase moves the session to phase without checking the transition;
+// callers validate with CheckTransition before committing the change.
+func (s *Session) SetPhase(phase SessionPhase) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Phase = phase
+}
@@ -0,0 +1,135 @@
+// File: backend/models/rating.go
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Ratings are scored on the same 1-5 scale the rating sliders use.
+const (
+	MinRatingScore = 1
+	MaxRatingScore = 5
+)
+
+var ErrIdeaNotFound = errors.New("idea does not exist")
+
+// Validate checks that every dimension is within the rating scale.
+func (r IdeaRating) Validate() error {
+	scores := []struct {
+		name  string
+		value int
+	}{
+		{"novelty", r.Novelty},
+		{"feasibility", r.Feasibility},
+		{"usefulness", r.Usefulness},
+	}
+	for _, score := range scores {
+		if score.value < MinRatingScore || score.value > MaxRatingScore {
+			return fmt.Errorf("%s must be between %d and %d", score.name, MinRatingScore, MaxRatingScore)
+		}
+	}
+	return nil
+}
+
+// ScoreStats summarizes the ratings for one dimension of an idea.
+type ScoreStats struct {
+	Mean     float64 `json:"mean"`
+	Median   float64 `json:"median"`
+	Variance float64 `json:"variance"`
+}
+
+// IdeaScores aggregates all ratings an idea received, per dimension.
+type IdeaScores struct {
+	Count       int        `json:"count"`
+	Novelty     ScoreStats `json:"novelty"`
+	Feasibility ScoreStats `json:"feasibility"`
+	Usefulness  ScoreStats `json:"usefulness"`
+}
+
+// RateIdea stores a user's rating for an idea, replacing any rating the same
+// user gave that idea before.
+func (s *Session) RateIdea(ideaID string, rating IdeaRating) error {
+	if err := rating.Validate(); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, idea := range s.Ideas {
+		if idea.ID != ideaID {
+			continue
+		}
+		for i, existing := range idea.Ratings {
+			if existing.UserID == rating.UserID {
+				idea.Ratings[i] = rating
+				return nil
+			}
+		}
+		idea.Ratings = append(idea.Ratings, rating)
+		return nil
+	}
+	return ErrIdeaNotFound
+}
+
+// ScoreIdea computes the rating aggregates for one idea.
+func (s *Session) ScoreIdea(ideaID string) (IdeaScores, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, idea := range s.Ideas {
+		if idea.ID == ideaID {
+			return idea.scores(), nil
+		}
+	}
+	return IdeaScores{}, ErrIdeaNotFound
+}
+
+func (i *Idea) scores() IdeaScores {
+	novelty := make([]int, 0, len(i.Ratings))
+	feasibility := make([]int, 0, len(i.Ratings))
+	usefulness := make([]int, 0, len(i.Ratings))
+	for _, rating := range i.Ratings {
+		novelty = append(novelty, rating.Novelty)
+		feasibility = append(feasibility, rating.Feasibility)
+		usefulness = append(usefulness, rating.Usefulness)
+	}
+	return IdeaScores{
+		Count:       len(i.Ratings),
+		Novelty:     computeScoreStats(novelty),
+		Feasibility: computeScoreStats(feasibility),
+		Usefulness:  computeScoreStats(usefulness),
+	}
+}
+
+// computeScoreStats returns the mean, median and population variance of
+// values, or zeroes when there are none.
+func computeScoreStats(values []int) ScoreStats {
+	if len(values) == 0 {
+		return ScoreStats{}
+	}
+	sorted := append([]int(nil), values...)
+	sort.Ints(sorted)
+
+	sum := 0
+	for _, v := range sorted {
+		sum += v
+	}
+	mean := float64(sum) / float64(len(sorted))
+
+	var median float64
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		median = float64(sorted[mid-1]+sorted[mid]) / 2
+	} else {
+		median = float64(sorted[mid])
+	}
+
+	var variance float64
+	for _, v := range sorted {
+		d := float64(v) - mean
+		variance += d * d
+	}
+	variance /= float64(len(sorted))
+
+	return ScoreStats{Mean: mean, Median: median, Variance: variance}
+}
@@ -0,0 +1,81 @@
+// File: backend/models/role.go
+package models
+
+// SessionRole decides what a user may do inside a session. Facilitators
+// steer the session, participants contribute ideas and ratings, observers
+// only watch.
+type SessionRole string
+
+const (
+	RoleFacilitator SessionRole = "facilitator"
+	RoleParticipant SessionRole = "participant"
+	RoleObserver    SessionRole = "observer"
+)
+
+func (r SessionRole) Valid() bool {
+	switch r {
+	case RoleFacilitator, RoleParticipant, RoleObserver:
+		return true
+	}
+	return false
+}
+
+// CanFacilitate reports whether the role may change phases, run
+// aggregation and manage other users.
+func (r SessionRole) CanFacilitate() bool {
+	return r == RoleFacilitator
+}
+
+// CanContribute reports whether the role may submit ideas, ratings and
+// chat messages.
+func (r SessionRole) CanContribute() bool {
+	return r == RoleFacilitator || r == RoleParticipant
+}
+
+// GetRole returns the user's role in the session. The creator is always a
+// facilitator; anyone without an explicit role is a participant.
+func (s *Session) GetRole(userID string) SessionRole {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if role, ok := s.Roles[userID]; ok {
+		return role
+	}
+	if userID == s.Creator.ID {
+		return RoleFacilitator
+	}
+	return RoleParticipant
+}
+
+// HasRole reports whether the user was given a role explicitly, e.g. when
+// they first joined.
+func (s *Session) HasRole(userID string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	_, ok := s.Roles[userID]
+	return ok
+}
+
+// Ban keeps a kicked user from joining the session again.
+func (s *Session) Ban(userID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.Banned == nil {
+		s.Banned = map[string]bool{}
+	}
+	s.Banned[userID] = true
+}
+
+func (s *Session) IsBanned(userID string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.Banned[userID]
+}
+
+func (s *Session) SetRole(userID string, role SessionRole) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.Roles == nil {
+		s.Roles = map[string]SessionRole{}
+	}
+	s.Roles[userID] = role
+}
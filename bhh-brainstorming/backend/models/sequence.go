@@ -0,0 +1,32 @@
+// File: backend/models/sequence.go
+package models
+
+// GetSeq returns the sequence number of the latest event applied to the
+// session.
+func (s *Session) GetSeq() int64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.Seq
+}
+
+// advanceSeq moves the session's sequence number on to seq, reporting
+// false when it was already there or beyond.
+func (s *Session) advanceSeq(seq int64) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if seq <= s.Seq {
+		return false
+	}
+	s.Seq = seq
+	return true
+}
+
+// NextSeq returns the SessionSeq of the next event of a session, 1 for a
+// session that does not exist yet.
+func (sm *SessionManager) NextSeq(sessionID string) int64 {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return 1
+	}
+	return session.GetSeq() + 1
+}
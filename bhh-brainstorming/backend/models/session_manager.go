@@ -29,17 +29,41 @@ type Idea struct {
 	MediaMeta   interface{}  `json:"mediaMeta,omitempty"` // metadata of the media file
 	SubmittedBy User         `json:"submittedBy"`
 	Ratings     []IdeaRating `json:"ratings"`
+	Transcript  string       `json:"transcript,omitempty"`  // speech-to-text of audio ideas
+	Description string       `json:"description,omitempty"` // text extracted from video and link ideas
+	// GuidingQuestion is the number, from 1, of the guiding question the
+	// idea answers; 0 when it is not tagged.
+	GuidingQuestion int `json:"guidingQuestion,omitempty"`
 }
 
 type Session struct {
-	ID               string           `json:"id"`
-	Name             string           `json:"name"`
-	GuidingQuestions []string         `json:"guidingQuestions"` // provided by team leader
-	CreatedAt        time.Time        `json:"createdAt"`
-	Creator          User             `json:"creator"`
-	Users            map[string]*User `json:"users"`
-	Ideas            []*Idea          `json:"ideas"` // collected idea submissions
-	mutex            sync.RWMutex
+	ID               string                 `json:"id"`
+	Name             string                 `json:"name"`
+	GuidingQuestions []string               `json:"guidingQuestions"` // provided by team leader
+	CreatedAt        time.Time              `json:"createdAt"`
+	Creator          User                   `json:"creator"`
+	Users            map[string]*User       `json:"users"`
+	Ideas            []*Idea                `json:"ideas"` // collected idea submissions
+	Phase            SessionPhase           `json:"phase"`
+	Roles            map[string]SessionRole `json:"roles"`                 // keyed by user ID
+	Aggregation      *Aggregation           `json:"aggregation,omitempty"` // latest AI summary of the ideas
+	Budget           float64                `json:"budget,omitempty"`      // cap on AI spending in US dollars
+	NudgesDisabled   bool                   `json:"nudgesDisabled,omitempty"`
+	// PromptTemplate and Model are chosen when the session is created and
+	// used for its aggregations; empty means the server's defaults.
+	PromptTemplate string `json:"promptTemplate,omitempty"`
+	Model          string `json:"model,omitempty"`
+	// Clustering groups similar ideas; nil until cluster_ideas is run.
+	Clustering *IdeaClustering `json:"clustering,omitempty"`
+	// Seq is the SessionSeq of the latest event applied to the session.
+	Seq int64 `json:"seq"`
+	// Banned holds the IDs of users kicked from the session, who may not
+	// join it again.
+	Banned map[string]bool `json:"banned,omitempty"`
+	// AggregationHistory holds every aggregation, oldest first. Clients
+	// fetch it separately, so it is left out of the session's JSON.
+	AggregationHistory []*Aggregation `json:"-"`
+	mutex              sync.RWMutex
 }
 
 func NewSession(id string, name string, guidingQuestions []string, creator User) *Session {
@@ -51,6 +75,8 @@ func NewSession(id string, name string, guidingQuestions []string, creator User)
 		Creator:          creator,
 		Users:            map[string]*User{creator.ID: &creator},
 		Ideas:            []*Idea{},
+		Phase:            PhaseCollect,
+		Roles:            map[string]SessionRole{creator.ID: RoleFacilitator},
 	}
 }
 
@@ -66,6 +92,13 @@ func (s *Session) RemoveUser(userID string) {
 	delete(s.Users, userID)
 }
 
+func (s *Session) HasUser(userID string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	_, ok := s.Users[userID]
+	return ok
+}
+
 func (s *Session) GetUsers() []*User {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
@@ -82,24 +115,98 @@ func (s *Session) AddIdea(idea *Idea) {
 	s.Ideas = append(s.Ideas, idea)
 }
 
+func (s *Session) GetIdea(ideaID string) (*Idea, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, idea := range s.Ideas {
+		if idea.ID == ideaID {
+			return idea, true
+		}
+	}
+	return nil, false
+}
+
+// SetTranscript stores the transcript of an audio idea.
+func (s *Session) SetTranscript(ideaID string, transcript string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, idea := range s.Ideas {
+		if idea.ID == ideaID {
+			idea.Transcript = transcript
+			return nil
+		}
+	}
+	return ErrIdeaNotFound
+}
+
+// SetDescription stores the text extracted from a video or link idea, along
+// with any metadata found while extracting it.
+func (s *Session) SetDescription(ideaID string, description string, mediaMeta interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, idea := range s.Ideas {
+		if idea.ID == ideaID {
+			idea.Description = description
+			if mediaMeta != nil {
+				idea.MediaMeta = mediaMeta
+			}
+			return nil
+		}
+	}
+	return ErrIdeaNotFound
+}
+
+var ErrSessionNotFound = errors.New("session does not exist")
+
 type SessionManager struct {
 	sessions map[string]*Session
+	store    SessionStore
 	mutex    sync.RWMutex
 }
 
 func NewSessionManager() *SessionManager {
+	return NewSessionManagerWithStore(NewMemoryStore())
+}
+
+// NewSessionManagerWithStore creates a manager that writes every change
+// through to store. Call Load to pick up sessions saved by a previous run.
+func NewSessionManagerWithStore(store SessionStore) *SessionManager {
 	return &SessionManager{
 		sessions: make(map[string]*Session),
+		store:    store,
 	}
 }
 
-func (sm *SessionManager) CreateSession(name string, guidingQuestions []string, creator User) *Session {
-	sessionID := generateSessionID()
-	session := NewSession(sessionID, name, guidingQuestions, creator)
+// Load replaces the in-memory sessions with those held by the store.
+func (sm *SessionManager) Load() error {
+	sessions, err := sm.store.LoadSessions()
+	if err != nil {
+		return err
+	}
 	sm.mutex.Lock()
-	sm.sessions[sessionID] = session
-	sm.mutex.Unlock()
-	return session
+	defer sm.mutex.Unlock()
+	sm.sessions = make(map[string]*Session, len(sessions))
+	for _, session := range sessions {
+		sm.sessions[session.ID] = session
+	}
+	return nil
+}
+
+// NewSessionID returns a session ID that is not in use yet.
+func (sm *SessionManager) NewSessionID() string {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	for {
+		sessionID := generateSessionID()
+		if _, exists := sm.sessions[sessionID]; !exists {
+			return sessionID
+		}
+	}
+}
+
+// SaveSession persists the current state of a session after it was changed.
+func (sm *SessionManager) SaveSession(session *Session) error {
+	return sm.store.SaveSession(session)
 }
 
 func (sm *SessionManager) GetSession(sessionID string) (*Session, error) {
@@ -107,7 +214,7 @@ func (sm *SessionManager) GetSession(sessionID string) (*Session, error) {
 	defer sm.mutex.RUnlock()
 	session, exists := sm.sessions[sessionID]
 	if !exists {
-		return nil, errors.New("session does not exist")
+		return nil, ErrSessionNotFound
 	}
 	return session, nil
 }
@@ -122,10 +229,11 @@ func (sm *SessionManager) ListSessions() []*Session {
 	return sessions
 }
 
-func (sm *SessionManager) RemoveSession(sessionID string) {
+func (sm *SessionManager) RemoveSession(sessionID string) error {
 	sm.mutex.Lock()
-	defer sm.mutex.Unlock()
 	delete(sm.sessions, sessionID)
+	sm.mutex.Unlock()
+	return sm.store.DeleteSession(sessionID)
 }
 
 func generateSessionID() string {
@@ -0,0 +1,583 @@
+// File: backend/models/sqlite_store.go
+package models
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteMigrations are applied in order; PRAGMA user_version records how many
+// have already run against a database file. Only ever append to this list.
+var sqliteMigrations = []string{
+	`CREATE TABLE sessions (
+		id                TEXT PRIMARY KEY,
+		name              TEXT NOT NULL,
+		guiding_questions TEXT NOT NULL,
+		created_at        TIMESTAMP NOT NULL,
+		creator_id        TEXT NOT NULL,
+		creator_username  TEXT NOT NULL
+	);
+	CREATE TABLE users (
+		session_id TEXT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+		id         TEXT NOT NULL,
+		username   TEXT NOT NULL,
+		PRIMARY KEY (session_id, id)
+	);
+	CREATE TABLE ideas (
+		session_id            TEXT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+		id                    TEXT NOT NULL,
+		position              INTEGER NOT NULL,
+		content               TEXT NOT NULL,
+		media_type            TEXT NOT NULL,
+		media_url             TEXT NOT NULL,
+		media_meta            TEXT,
+		submitted_by_id       TEXT NOT NULL,
+		submitted_by_username TEXT NOT NULL,
+		PRIMARY KEY (session_id, id)
+	);
+	CREATE TABLE ratings (
+		session_id  TEXT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+		idea_id     TEXT NOT NULL,
+		user_id     TEXT NOT NULL,
+		novelty     INTEGER NOT NULL,
+		feasibility INTEGER NOT NULL,
+		usefulness  INTEGER NOT NULL,
+		comment     TEXT NOT NULL,
+		PRIMARY KEY (session_id, idea_id, user_id)
+	);`,
+	`ALTER TABLE sessions ADD COLUMN phase TEXT NOT NULL DEFAULT 'collect';`,
+	`CREATE TABLE roles (
+		session_id TEXT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+		user_id    TEXT NOT NULL,
+		role       TEXT NOT NULL,
+		PRIMARY KEY (session_id, user_id)
+	);`,
+	`ALTER TABLE sessions ADD COLUMN aggregation TEXT;`,
+	`ALTER TABLE ideas ADD COLUMN transcript TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE ideas ADD COLUMN description TEXT NOT NULL DEFAULT '';`,
+	`CREATE TABLE media_cache (
+		key        TEXT PRIMARY KEY,
+		content    TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	);`,
+	`CREATE TABLE aggregations (
+		session_id  TEXT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+		position    INTEGER NOT NULL,
+		aggregation TEXT NOT NULL,
+		PRIMARY KEY (session_id, position)
+	);`,
+	`ALTER TABLE sessions ADD COLUMN budget REAL NOT NULL DEFAULT 0;
+	CREATE TABLE llm_usage (
+		session_id        TEXT NOT NULL,
+		operation         TEXT NOT NULL,
+		model             TEXT NOT NULL,
+		prompt_tokens     INTEGER NOT NULL,
+		completion_tokens INTEGER NOT NULL,
+		created_at        TIMESTAMP NOT NULL
+	);
+	CREATE INDEX llm_usage_session ON llm_usage (session_id);`,
+	`ALTER TABLE sessions ADD COLUMN prompt_template TEXT NOT NULL DEFAULT '';
+	ALTER TABLE sessions ADD COLUMN model TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE ideas ADD COLUMN guiding_question INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE sessions ADD COLUMN clustering TEXT;`,
+	`ALTER TABLE sessions ADD COLUMN nudges_disabled INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE sessions ADD COLUMN seq INTEGER NOT NULL DEFAULT 0;`,
+	`CREATE TABLE bans (
+		session_id TEXT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+		user_id    TEXT NOT NULL,
+		PRIMARY KEY (session_id, user_id)
+	);`,
+	// Embeddings used to be kept in media_cache; they are cheap to redo
+	`CREATE TABLE embeddings (
+		text_hash  TEXT NOT NULL,
+		model      TEXT NOT NULL,
+		version    TEXT NOT NULL,
+		vector     BLOB NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (text_hash, model, version)
+	);
+	DELETE FROM media_cache WHERE key LIKE '%|embedding|%';`,
+}
+
+// SQLiteStore persists sessions in an embedded SQLite database file.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+	db, err := sql.Open("sqlite3", path+"?_foreign_keys=on&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer; serializing through one connection
+	// avoids "database is locked" errors under concurrent saves.
+	db.SetMaxOpenConns(1)
+	store := &SQLiteStore{db: db}
+	if err := store.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *SQLiteStore) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	for i := version; i < len(sqliteMigrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) SaveSession(session *Session) error {
+	session.mutex.RLock()
+	defer session.mutex.RUnlock()
+
+	guidingQuestions, err := json.Marshal(session.GuidingQuestions)
+	if err != nil {
+		return err
+	}
+
+	var aggregation sql.NullString
+	if session.Aggregation != nil {
+		encoded, err := json.Marshal(session.Aggregation)
+		if err != nil {
+			return err
+		}
+		aggregation = sql.NullString{String: string(encoded), Valid: true}
+	}
+
+	var clustering sql.NullString
+	if session.Clustering != nil {
+		encoded, err := json.Marshal(session.Clustering)
+		if err != nil {
+			return err
+		}
+		clustering = sql.NullString{String: string(encoded), Valid: true}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO sessions (id, name, guiding_questions, created_at, creator_id, creator_username, phase, aggregation, budget, prompt_template, model, clustering, nudges_disabled, seq)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			name = excluded.name,
+			guiding_questions = excluded.guiding_questions,
+			creator_id = excluded.creator_id,
+			creator_username = excluded.creator_username,
+			phase = excluded.phase,
+			aggregation = excluded.aggregation,
+			budget = excluded.budget,
+			prompt_template = excluded.prompt_template,
+			model = excluded.model,
+			clustering = excluded.clustering,
+			nudges_disabled = excluded.nudges_disabled,
+			seq = excluded.seq`,
+		session.ID, session.Name, string(guidingQuestions), session.CreatedAt,
+		session.Creator.ID, session.Creator.Username, string(session.Phase), aggregation, session.Budget,
+		session.PromptTemplate, session.Model, clustering, session.NudgesDisabled, session.Seq)
+	if err != nil {
+		return err
+	}
+
+	// Child rows are rewritten wholesale; sessions are small enough that this
+	// is simpler and safer than diffing against what is already stored.
+	for _, table := range []string{"users", "roles", "bans", "ideas", "ratings", "aggregations"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE session_id = ?", session.ID); err != nil {
+			return err
+		}
+	}
+
+	for _, user := range session.Users {
+		if _, err := tx.Exec(`INSERT INTO users (session_id, id, username) VALUES (?, ?, ?)`,
+			session.ID, user.ID, user.Username); err != nil {
+			return err
+		}
+	}
+
+	for userID, role := range session.Roles {
+		if _, err := tx.Exec(`INSERT INTO roles (session_id, user_id, role) VALUES (?, ?, ?)`,
+			session.ID, userID, string(role)); err != nil {
+			return err
+		}
+	}
+
+	for userID := range session.Banned {
+		if _, err := tx.Exec(`INSERT INTO bans (session_id, user_id) VALUES (?, ?)`,
+			session.ID, userID); err != nil {
+			return err
+		}
+	}
+
+	for position, idea := range session.Ideas {
+		var mediaMeta sql.NullString
+		if idea.MediaMeta != nil {
+			meta, err := json.Marshal(idea.MediaMeta)
+			if err != nil {
+				return err
+			}
+			mediaMeta = sql.NullString{String: string(meta), Valid: true}
+		}
+		if _, err := tx.Exec(`INSERT INTO ideas (session_id, id, position, content, media_type, media_url,
+				media_meta, submitted_by_id, submitted_by_username, transcript, description, guiding_question)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			session.ID, idea.ID, position, idea.Content, idea.MediaType, idea.MediaURL,
+			mediaMeta, idea.SubmittedBy.ID, idea.SubmittedBy.Username, idea.Transcript, idea.Description,
+			idea.GuidingQuestion); err != nil {
+			return err
+		}
+		for _, rating := range idea.Ratings {
+			if _, err := tx.Exec(`INSERT INTO ratings (session_id, idea_id, user_id, novelty, feasibility, usefulness, comment)
+				VALUES (?, ?, ?, ?, ?, ?, ?)`,
+				session.ID, idea.ID, rating.UserID, rating.Novelty, rating.Feasibility,
+				rating.Usefulness, rating.Comment); err != nil {
+				return err
+			}
+		}
+	}
+
+	for position, aggregation := range session.AggregationHistory {
+		encoded, err := json.Marshal(aggregation)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO aggregations (session_id, position, aggregation) VALUES (?, ?, ?)`,
+			session.ID, position, string(encoded)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) DeleteSession(sessionID string) error {
+	_, err := s.db.Exec("DELETE FROM sessions WHERE id = ?", sessionID)
+	return err
+}
+
+func (s *SQLiteStore) LoadSessions() ([]*Session, error) {
+	rows, err := s.db.Query(`SELECT id, name, guiding_questions, created_at, creator_id, creator_username, phase, aggregation, budget, prompt_template, model, clustering, nudges_disabled, seq
+		FROM sessions ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	sessions := []*Session{}
+	byID := map[string]*Session{}
+	for rows.Next() {
+		var guidingQuestions string
+		var aggregation, clustering sql.NullString
+		session := &Session{
+			Users: map[string]*User{},
+			Ideas: []*Idea{},
+			Roles: map[string]SessionRole{},
+		}
+		if err := rows.Scan(&session.ID, &session.Name, &guidingQuestions, &session.CreatedAt,
+			&session.Creator.ID, &session.Creator.Username, &session.Phase, &aggregation, &session.Budget,
+			&session.PromptTemplate, &session.Model, &clustering, &session.NudgesDisabled, &session.Seq); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(guidingQuestions), &session.GuidingQuestions); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if aggregation.Valid {
+			if err := json.Unmarshal([]byte(aggregation.String), &session.Aggregation); err != nil {
+				rows.Close()
+				return nil, err
+			}
+		}
+		if clustering.Valid {
+			if err := json.Unmarshal([]byte(clustering.String), &session.Clustering); err != nil {
+				rows.Close()
+				return nil, err
+			}
+		}
+		sessions = append(sessions, session)
+		byID[session.ID] = session
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.loadUsers(byID); err != nil {
+		return nil, err
+	}
+	if err := s.loadRoles(byID); err != nil {
+		return nil, err
+	}
+	if err := s.loadBans(byID); err != nil {
+		return nil, err
+	}
+	ideas, err := s.loadIdeas(byID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.loadRatings(ideas); err != nil {
+		return nil, err
+	}
+	if err := s.loadAggregations(byID); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (s *SQLiteStore) loadUsers(sessions map[string]*Session) error {
+	rows, err := s.db.Query("SELECT session_id, id, username FROM users")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sessionID string
+		user := &User{}
+		if err := rows.Scan(&sessionID, &user.ID, &user.Username); err != nil {
+			return err
+		}
+		if session, ok := sessions[sessionID]; ok {
+			session.Users[user.ID] = user
+		}
+	}
+	return rows.Err()
+}
+
+func (s *SQLiteStore) loadRoles(sessions map[string]*Session) error {
+	rows, err := s.db.Query("SELECT session_id, user_id, role FROM roles")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sessionID, userID string
+		var role SessionRole
+		if err := rows.Scan(&sessionID, &userID, &role); err != nil {
+			return err
+		}
+		if session, ok := sessions[sessionID]; ok {
+			session.Roles[userID] = role
+		}
+	}
+	return rows.Err()
+}
+
+func (s *SQLiteStore) loadBans(sessions map[string]*Session) error {
+	rows, err := s.db.Query("SELECT session_id, user_id FROM bans")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sessionID, userID string
+		if err := rows.Scan(&sessionID, &userID); err != nil {
+			return err
+		}
+		if session, ok := sessions[sessionID]; ok {
+			session.Ban(userID)
+		}
+	}
+	return rows.Err()
+}
+
+// loadIdeas attaches ideas to their sessions and returns them keyed by
+// session ID and idea ID so ratings can be attached afterwards.
+func (s *SQLiteStore) loadIdeas(sessions map[string]*Session) (map[[2]string]*Idea, error) {
+	rows, err := s.db.Query(`SELECT session_id, id, content, media_type, media_url, media_meta,
+			submitted_by_id, submitted_by_username, transcript, description, guiding_question
+		FROM ideas ORDER BY session_id, position`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ideas := map[[2]string]*Idea{}
+	for rows.Next() {
+		var sessionID string
+		var mediaMeta sql.NullString
+		idea := &Idea{Ratings: []IdeaRating{}}
+		if err := rows.Scan(&sessionID, &idea.ID, &idea.Content, &idea.MediaType, &idea.MediaURL,
+			&mediaMeta, &idea.SubmittedBy.ID, &idea.SubmittedBy.Username, &idea.Transcript, &idea.Description,
+			&idea.GuidingQuestion); err != nil {
+			return nil, err
+		}
+		if mediaMeta.Valid {
+			if err := json.Unmarshal([]byte(mediaMeta.String), &idea.MediaMeta); err != nil {
+				return nil, err
+			}
+		}
+		if session, ok := sessions[sessionID]; ok {
+			session.Ideas = append(session.Ideas, idea)
+			ideas[[2]string{sessionID, idea.ID}] = idea
+		}
+	}
+	return ideas, rows.Err()
+}
+
+func (s *SQLiteStore) loadRatings(ideas map[[2]string]*Idea) error {
+	rows, err := s.db.Query(`SELECT session_id, idea_id, user_id, novelty, feasibility, usefulness, comment
+		FROM ratings ORDER BY rowid`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sessionID, ideaID string
+		var rating IdeaRating
+		if err := rows.Scan(&sessionID, &ideaID, &rating.UserID, &rating.Novelty, &rating.Feasibility,
+			&rating.Usefulness, &rating.Comment); err != nil {
+			return err
+		}
+		if idea, ok := ideas[[2]string{sessionID, ideaID}]; ok {
+			idea.Ratings = append(idea.Ratings, rating)
+		}
+	}
+	return rows.Err()
+}
+
+// loadAggregations attaches each session's aggregation history. Databases
+// from before the history only have the latest aggregation, which becomes
+// the first entry.
+func (s *SQLiteStore) loadAggregations(sessions map[string]*Session) error {
+	rows, err := s.db.Query("SELECT session_id, aggregation FROM aggregations ORDER BY session_id, position")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sessionID, encoded string
+		if err := rows.Scan(&sessionID, &encoded); err != nil {
+			return err
+		}
+		aggregation := &Aggregation{}
+		if err := json.Unmarshal([]byte(encoded), aggregation); err != nil {
+			return err
+		}
+		if session, ok := sessions[sessionID]; ok {
+			session.AggregationHistory = append(session.AggregationHistory, aggregation)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if session.Aggregation != nil && len(session.AggregationHistory) == 0 {
+			session.AddAggregation(session.Aggregation)
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) LoadCachedMedia(key string) (string, time.Time, bool, error) {
+	var content string
+	var savedAt time.Time
+	err := s.db.QueryRow("SELECT content, created_at FROM media_cache WHERE key = ?", key).Scan(&content, &savedAt)
+	if err == sql.ErrNoRows {
+		return "", time.Time{}, false, nil
+	}
+	if err != nil {
+		return "", time.Time{}, false, err
+	}
+	return content, savedAt, true, nil
+}
+
+func (s *SQLiteStore) SaveCachedMedia(key string, content string) error {
+	_, err := s.db.Exec(`INSERT INTO media_cache (key, content, created_at) VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET content = excluded.content, created_at = excluded.created_at`,
+		key, content, time.Now())
+	return err
+}
+
+// LoadEmbedding reads a vector stored as little-endian float32s.
+func (s *SQLiteStore) LoadEmbedding(key EmbeddingKey) ([]float32, bool, error) {
+	var encoded []byte
+	err := s.db.QueryRow("SELECT vector FROM embeddings WHERE text_hash = ? AND model = ? AND version = ?",
+		key.TextHash, key.Model, key.Version).Scan(&encoded)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if len(encoded)%4 != 0 {
+		return nil, false, fmt.Errorf("embedding of %d bytes is not a float32 vector", len(encoded))
+	}
+	vector := make([]float32, len(encoded)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(encoded[i*4:]))
+	}
+	return vector, true, nil
+}
+
+func (s *SQLiteStore) SaveEmbedding(key EmbeddingKey, vector []float32) error {
+	encoded := make([]byte, 0, len(vector)*4)
+	for _, value := range vector {
+		encoded = binary.LittleEndian.AppendUint32(encoded, math.Float32bits(value))
+	}
+	_, err := s.db.Exec(`INSERT INTO embeddings (text_hash, model, version, vector, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(text_hash, model, version) DO UPDATE SET vector = excluded.vector, created_at = excluded.created_at`,
+		key.TextHash, key.Model, key.Version, encoded, time.Now())
+	return err
+}
+
+func (s *SQLiteStore) RecordUsage(record UsageRecord) error {
+	_, err := s.db.Exec(`INSERT INTO llm_usage (session_id, operation, model, prompt_tokens, completion_tokens, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		record.SessionID, record.Operation, record.Model, record.PromptTokens, record.CompletionTokens, record.CreatedAt)
+	return err
+}
+
+func (s *SQLiteStore) LoadUsage(sessionID string) ([]UsageRecord, error) {
+	rows, err := s.db.Query(`SELECT session_id, operation, model, prompt_tokens, completion_tokens, created_at
+		FROM llm_usage WHERE ? = '' OR session_id = ? ORDER BY rowid`, sessionID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	records := []UsageRecord{}
+	for rows.Next() {
+		var record UsageRecord
+		if err := rows.Scan(&record.SessionID, &record.Operation, &record.Model,
+			&record.PromptTokens, &record.CompletionTokens, &record.CreatedAt); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,34 @@
+// File: backend/models/sqlite_store_test.go
+package models
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSQLiteStoreKeepsEmbeddings(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer store.Close()
+
+	key := EmbeddingKey{TextHash: "abc", Model: "hashing", Version: "1"}
+	vector := []float32{0.25, -1.5, 3e-7}
+	if err := store.SaveEmbedding(key, vector); err != nil {
+		t.Fatalf("SaveEmbedding: %v", err)
+	}
+	loaded, found, err := store.LoadEmbedding(key)
+	if err != nil || !found {
+		t.Fatalf("LoadEmbedding = %v, %v", found, err)
+	}
+	if !slices.Equal(loaded, vector) {
+		t.Fatalf("LoadEmbedding = %v, want %v", loaded, vector)
+	}
+
+	key.Model = "another-model"
+	if _, found, _ := store.LoadEmbedding(key); found {
+		t.Fatalf("the vector of one model was found for another")
+	}
+}
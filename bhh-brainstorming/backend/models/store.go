@@ -0,0 +1,183 @@
+// File: backend/models/store.go
+package models
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// SessionStore persists sessions so they survive a backend restart.
+// SaveSession is called after every change to a session and must replace
+// whatever was stored for that session ID before.
+type SessionStore interface {
+	SaveSession(session *Session) error
+	DeleteSession(sessionID string) error
+	LoadSessions() ([]*Session, error)
+	MediaCacheStore
+	EmbeddingStore
+	UsageStore
+	Close() error
+}
+
+// MediaCacheStore keeps the text extracted from processed media, keyed by
+// a string that identifies the media and how it was processed. Entries are
+// not tied to a session and outlive them. LoadCachedMedia also reports when
+// the entry was saved, so callers can ignore entries they consider stale.
+type MediaCacheStore interface {
+	LoadCachedMedia(key string) (content string, savedAt time.Time, found bool, err error)
+	SaveCachedMedia(key string, content string) error
+}
+
+// EmbeddingKey identifies the embedding of one text: a hash of the text,
+// the embedding model and the version of how idea texts are put together.
+type EmbeddingKey struct {
+	TextHash string
+	Model    string
+	Version  string
+}
+
+// EmbeddingStore keeps the embedding vectors of idea texts so ideas are not
+// embedded again after a restart. Like media descriptions, they outlive
+// sessions.
+type EmbeddingStore interface {
+	LoadEmbedding(key EmbeddingKey) (vector []float32, found bool, err error)
+	SaveEmbedding(key EmbeddingKey, vector []float32) error
+}
+
+// MemoryStore keeps sessions in process memory only. Nothing survives a
+// restart; it is the store used when no database is configured.
+type MemoryStore struct {
+	sessions   map[string]memorySession
+	mediaCache map[string]cachedMedia
+	embeddings map[EmbeddingKey][]float32
+	usage      []UsageRecord
+	mutex      sync.RWMutex
+}
+
+// memorySession is a saved session. The aggregation history is not part of
+// a session's JSON, so it is kept next to it.
+type memorySession struct {
+	data    []byte
+	history []byte
+}
+
+type cachedMedia struct {
+	content string
+	savedAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions:   make(map[string]memorySession),
+		mediaCache: make(map[string]cachedMedia),
+		embeddings: make(map[EmbeddingKey][]float32),
+	}
+}
+
+func (m *MemoryStore) SaveSession(session *Session) error {
+	// Store a serialized copy so later in-place changes to the live session
+	// only become visible once they are saved again.
+	session.mutex.RLock()
+	data, err := json.Marshal(session)
+	if err != nil {
+		session.mutex.RUnlock()
+		return err
+	}
+	history, err := json.Marshal(session.AggregationHistory)
+	session.mutex.RUnlock()
+	if err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.sessions[session.ID] = memorySession{data: data, history: history}
+	return nil
+}
+
+func (m *MemoryStore) DeleteSession(sessionID string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.sessions, sessionID)
+	return nil
+}
+
+func (m *MemoryStore) LoadSessions() ([]*Session, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, saved := range m.sessions {
+		session := &Session{}
+		if err := json.Unmarshal(saved.data, session); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(saved.history, &session.AggregationHistory); err != nil {
+			return nil, err
+		}
+		if session.Users == nil {
+			session.Users = map[string]*User{}
+		}
+		if session.Ideas == nil {
+			session.Ideas = []*Idea{}
+		}
+		if session.Phase == "" {
+			session.Phase = PhaseCollect
+		}
+		if session.Roles == nil {
+			session.Roles = map[string]SessionRole{}
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+func (m *MemoryStore) LoadCachedMedia(key string) (string, time.Time, bool, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	entry, found := m.mediaCache[key]
+	return entry.content, entry.savedAt, found, nil
+}
+
+func (m *MemoryStore) SaveCachedMedia(key string, content string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.mediaCache[key] = cachedMedia{content: content, savedAt: time.Now()}
+	return nil
+}
+
+func (m *MemoryStore) LoadEmbedding(key EmbeddingKey) ([]float32, bool, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	vector, found := m.embeddings[key]
+	return vector, found, nil
+}
+
+func (m *MemoryStore) SaveEmbedding(key EmbeddingKey, vector []float32) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.embeddings[key] = vector
+	return nil
+}
+
+func (m *MemoryStore) RecordUsage(record UsageRecord) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.usage = append(m.usage, record)
+	return nil
+}
+
+func (m *MemoryStore) LoadUsage(sessionID string) ([]UsageRecord, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	records := []UsageRecord{}
+	for _, record := range m.usage {
+		if sessionID == "" || record.SessionID == sessionID {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,37 @@
+// File: backend/models/usage.go
+package models
+
+import "time"
+
+// UsageRecord is the token usage of one model call made for a session.
+type UsageRecord struct {
+	SessionID        string    `json:"sessionId"`
+	Operation        string    `json:"operation"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"promptTokens"`
+	CompletionTokens int       `json:"completionTokens"`
+	CreatedAt        time.Time `json:"createdAt"`
+}
+
+// UsageStore keeps usage records. Like the media cache they are not tied
+// to a session's lifetime, so a workshop's cost is still known after its
+// session is gone.
+type UsageStore interface {
+	RecordUsage(record UsageRecord) error
+	// LoadUsage returns the records of one session, or of all sessions when
+	// sessionID is empty, oldest first.
+	LoadUsage(sessionID string) ([]UsageRecord, error)
+}
+
+// GetBudget returns the session's AI budget in US dollars; 0 means none.
+func (s *Session) GetBudget() float64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.Budget
+}
+
+func (s *Session) SetBudget(budget float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Budget = budget
+}
@@ -0,0 +1,424 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"bhh-brainstorming/backend/models"
+)
+
+const (
+	// DefaultBatchTokenLimit keeps each aggregation request well inside the
+	// context window of the aggregation model.
+	DefaultBatchTokenLimit = 24000
+	// DefaultMaxParallel limits how many aggregation requests run at once.
+	DefaultMaxParallel = 4
+
+	// DefaultAggregationModel summarizes and merges ideas.
+	DefaultAggregationModel = "gpt-4o"
+)
+
+// ErrNoIdeas is returned when a session is aggregated before it has ideas.
+var ErrNoIdeas = errors.New("there are no ideas to aggregate")
+
+// AggregationConfig picks the model and prompts of one aggregation.
+type AggregationConfig struct {
+	Model    string          // empty means the processor's AggregationModel
+	Template *PromptTemplate // nil means the default template
+	Session  PromptData
+}
+
+// aggregationPrompts are the rendered prompts of one aggregation.
+type aggregationPrompts struct {
+	template  *PromptTemplate
+	model     string
+	system    string
+	summarize string
+	batch     string
+	reduce    string
+}
+
+func (mp *MediaProcessor) renderPrompts(config AggregationConfig) (aggregationPrompts, error) {
+	prompts := aggregationPrompts{template: config.Template, model: config.Model}
+	if prompts.template == nil {
+		var ok bool
+		if prompts.template, ok = mp.Prompts.Get(DefaultPromptTemplate); !ok {
+			return prompts, fmt.Errorf("no %q prompt template", DefaultPromptTemplate)
+		}
+	}
+	if prompts.model == "" {
+		prompts.model = mp.AggregationModel
+	}
+	for block, rendered := range map[string]*string{
+		"system":          &prompts.system,
+		"summarize":       &prompts.summarize,
+		"summarize_batch": &prompts.batch,
+		"reduce":          &prompts.reduce,
+	} {
+		var err error
+		if *rendered, err = prompts.template.Render(block, config.Session); err != nil {
+			return prompts, err
+		}
+	}
+	return prompts, nil
+}
+
+// Aggregation stages reported through AggregationHooks.OnStage.
+const (
+	StageProcess = "process" // turning ideas into text
+	StageMap     = "map"     // summarizing batches of ideas
+	StageReduce  = "reduce"  // merging partial summaries
+)
+
+// AggregationStage reports how far an aggregation has come. Level counts
+// reduce rounds, starting at 1.
+type AggregationStage struct {
+	Stage     string `json:"stage"`
+	Level     int    `json:"level,omitempty"`
+	Completed int    `json:"completed"`
+	Total     int    `json:"total"`
+}
+
+// AggregationHooks lets callers follow a running aggregation. Both are
+// optional; OnStage may be called from several goroutines at once.
+type AggregationHooks struct {
+	OnDelta func(delta string)           // streamed summary of the final request
+	OnStage func(stage AggregationStage) // called as each step finishes
+}
+
+func (h AggregationHooks) stage(stage AggregationStage) {
+	if h.OnStage != nil {
+		h.OnStage(stage)
+	}
+}
+
+// estimateTokens approximates the token count of English text at four
+// characters per token, which is close enough for batching.
+func estimateTokens(text string) int {
+	return len(text)/4 + 4
+}
+
+// AggregateMedia asks the model for a structured summary of all items and
+// validates it into an Aggregation. Ideas that fit into one request are
+// summarized directly. Larger sessions are split into batches that are
+// summarized in parallel and then merged, level by level, into one result.
+// Only the summary text of the final request is streamed to hooks.OnDelta.
+func (mp *MediaProcessor) AggregateMedia(ctx context.Context, items []MediaItem, config AggregationConfig, hooks AggregationHooks) (*models.Aggregation, error) {
+	log.Println("Starting to process", len(items), "items for aggregation")
+	if len(items) == 0 {
+		return nil, ErrNoIdeas
+	}
+	if hooks.OnDelta != nil {
+		// The reply is JSON; show listeners the summary inside it
+		hooks.OnDelta = newSummaryStream(hooks.OnDelta).Write
+	}
+
+	prompts, err := mp.renderPrompts(config)
+	if err != nil {
+		return nil, err
+	}
+
+	texts, failed, err := mp.processItems(ctx, items, hooks)
+	if err != nil {
+		return nil, err
+	}
+	if len(failed) > 0 && len(failed) == len(items) {
+		return nil, fmt.Errorf("none of the %d ideas could be processed: %s", len(items), failed[0].Error)
+	}
+
+	skipped := make(map[string]bool, len(failed))
+	for _, f := range failed {
+		skipped[f.IdeaID] = true
+	}
+	entries := make([]string, 0, len(items))
+	ideaIDs := make([]string, 0, len(items))
+	for i, item := range items {
+		if skipped[item.ID] {
+			continue
+		}
+		content := texts[i]
+		log.Printf("Processed content for item %d: %s", i, content[:min(len(content), 100)])
+
+		entry := ideaIDPrefix + item.ID + "\n"
+		if item.GuidingQuestion > 0 {
+			entry += guidingQuestionPrefix + strconv.Itoa(item.GuidingQuestion) + "\n"
+		}
+		entry += "Content from " + item.MediaType + ": " + content
+		if estimateTokens(entry) > mp.batchTokenLimit() {
+			entry = truncateUTF8(entry, (mp.batchTokenLimit()-4)*4)
+		}
+		entries = append(entries, entry)
+		ideaIDs = append(ideaIDs, item.ID)
+	}
+
+	aggregation, err := mp.aggregateEntries(ctx, prompts, entries, ideaIDs, hooks)
+	if err != nil {
+		return nil, err
+	}
+	aggregation.PromptTemplate = prompts.template.Name
+	aggregation.PromptVersion = prompts.template.Version
+	aggregation.IdeaIDs = ideaIDs
+	aggregation.FailedIdeas = failed
+	tags := map[string]int{}
+	for _, item := range items {
+		tags[item.ID] = item.GuidingQuestion
+	}
+	aggregation.AssignSections(len(config.Session.GuidingQuestions), tags)
+	return aggregation, nil
+}
+
+func (mp *MediaProcessor) aggregateEntries(ctx context.Context, prompts aggregationPrompts, entries []string, ideaIDs []string, hooks AggregationHooks) (*models.Aggregation, error) {
+	batches := batchByTokens(entries, mp.batchTokenLimit())
+	if len(batches) <= 1 {
+		return mp.requestAggregation(ctx, prompts, entries, prompts.summarize, ideaIDs, hooks.OnDelta)
+	}
+
+	log.Printf("Aggregating %d ideas in %d batches", len(entries), len(batches))
+	partials, err := mp.runParallel(ctx, len(batches), func(ctx context.Context, i int) (*models.Aggregation, error) {
+		var batchEntries, batchIDs []string
+		for _, index := range batches[i] {
+			batchEntries = append(batchEntries, entries[index])
+			batchIDs = append(batchIDs, ideaIDs[index])
+		}
+		partial, err := mp.requestAggregation(ctx, prompts, batchEntries, prompts.batch, batchIDs, nil)
+		if err != nil {
+			return nil, err
+		}
+		partial.IdeaIDs = batchIDs
+		return partial, nil
+	}, func(completed int) {
+		hooks.stage(AggregationStage{Stage: StageMap, Completed: completed, Total: len(batches)})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return mp.reduceAggregations(ctx, prompts, partials, hooks)
+}
+
+// reduceAggregations merges partial aggregations in token-bounded groups
+// until a single one is left. The last merge is streamed.
+func (mp *MediaProcessor) reduceAggregations(ctx context.Context, prompts aggregationPrompts, partials []*models.Aggregation, hooks AggregationHooks) (*models.Aggregation, error) {
+	for level := 1; ; level++ {
+		rendered := make([]string, len(partials))
+		for i, partial := range partials {
+			encoded, err := json.Marshal(partial)
+			if err != nil {
+				return nil, err
+			}
+			rendered[i] = partialAggregationPrefix + string(encoded)
+		}
+
+		groups := batchByTokens(rendered, mp.batchTokenLimit())
+		if len(groups) == len(partials) {
+			// Every partial fills a request on its own; merge pairs anyway so
+			// each level makes progress
+			groups = pairUp(len(partials))
+		}
+		if len(groups) == 1 {
+			return mp.mergeGroup(ctx, prompts, partials, rendered, groups[0], hooks.OnDelta)
+		}
+
+		log.Printf("Reduce level %d: merging %d partial aggregations into %d", level, len(partials), len(groups))
+		merged, err := mp.runParallel(ctx, len(groups), func(ctx context.Context, i int) (*models.Aggregation, error) {
+			if len(groups[i]) == 1 {
+				return partials[groups[i][0]], nil
+			}
+			return mp.mergeGroup(ctx, prompts, partials, rendered, groups[i], nil)
+		}, func(completed int) {
+			hooks.stage(AggregationStage{Stage: StageReduce, Level: level, Completed: completed, Total: len(groups)})
+		})
+		if err != nil {
+			return nil, err
+		}
+		partials = merged
+	}
+}
+
+func (mp *MediaProcessor) mergeGroup(ctx context.Context, prompts aggregationPrompts, partials []*models.Aggregation, rendered []string, group []int, onDelta func(string)) (*models.Aggregation, error) {
+	var groupEntries, groupIDs []string
+	seen := map[string]bool{}
+	for _, index := range group {
+		groupEntries = append(groupEntries, rendered[index])
+		// Every idea of a partial counts, not only those in its themes:
+		// suggestions and the merged themes may refer to any of them
+		ids := partials[index].IdeaIDs
+		for _, theme := range partials[index].Themes {
+			ids = append(ids[:len(ids):len(ids)], theme.IdeaIDs...)
+		}
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				groupIDs = append(groupIDs, id)
+			}
+		}
+	}
+	merged, err := mp.requestAggregation(ctx, prompts, groupEntries, prompts.reduce, groupIDs, onDelta)
+	if err != nil {
+		return nil, err
+	}
+	merged.IdeaIDs = groupIDs
+	carrySuggestions(merged, partials, group)
+	return merged, nil
+}
+
+// carrySuggestions keeps the question suggestions of the partials that the
+// merged aggregation left out, so no idea loses its suggestion in a merge.
+func carrySuggestions(merged *models.Aggregation, partials []*models.Aggregation, group []int) {
+	suggested := map[string]bool{}
+	for _, suggestion := range merged.Suggestions {
+		suggested[suggestion.IdeaID] = true
+	}
+	for _, index := range group {
+		for _, suggestion := range partials[index].Suggestions {
+			if !suggested[suggestion.IdeaID] {
+				suggested[suggestion.IdeaID] = true
+				merged.Suggestions = append(merged.Suggestions, suggestion)
+			}
+		}
+	}
+}
+
+// requestAggregation sends one aggregation request: the system prompt, one
+// message per entry and a closing instruction. The reply is validated
+// against ideaIDs.
+func (mp *MediaProcessor) requestAggregation(ctx context.Context, prompts aggregationPrompts, entries []string, instruction string, ideaIDs []string, onDelta func(string)) (*models.Aggregation, error) {
+	messages := []Message{CreateMessage("system", Content{ContentType: "text", Text: prompts.system})}
+	for _, entry := range entries {
+		messages = append(messages, CreateMessage("user", Content{ContentType: "text", Text: entry}))
+	}
+	messages = append(messages, CreateMessage("user", Content{ContentType: "text", Text: instruction}))
+
+	log.Printf("Sending %d messages to the model for aggregation", len(messages))
+
+	request := APIRequest{
+		Model:          prompts.model,
+		Messages:       messages,
+		ResponseSchema: aggregationSchema,
+	}
+
+	ctx = withOperation(ctx, OperationAggregation)
+	var completion Completion
+	var err error
+	if onDelta != nil {
+		completion, err = mp.Provider.Stream(ctx, request, onDelta)
+	} else {
+		completion, err = mp.Provider.Complete(ctx, request)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	aggregation, err := models.ParseAggregation(completion.Content, ideaIDs)
+	if err != nil {
+		log.Printf("Rejected aggregation reply: %s", completion.Content[:min(len(completion.Content), 500)])
+		return nil, err
+	}
+	aggregation.Model = completion.Model
+	aggregation.CreatedAt = time.Now()
+	return aggregation, nil
+}
+
+// runParallel calls fn for 0..n-1 with at most MaxParallel calls in flight
+// and returns the results in order. The first error cancels the rest.
+// onDone receives the number of finished calls after each one.
+func (mp *MediaProcessor) runParallel(ctx context.Context, n int, fn func(ctx context.Context, i int) (*models.Aggregation, error), onDone func(completed int)) ([]*models.Aggregation, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]*models.Aggregation, n)
+	slots := make(chan struct{}, mp.maxParallel())
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var firstErr error
+	completed := 0
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				return
+			}
+			result, err := fn(ctx, i)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				return
+			}
+			results[i] = result
+			completed++
+			onDone(completed)
+		}(i)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// batchByTokens groups consecutive texts so each group's estimated size
+// stays within limit. A text larger than limit gets a group of its own.
+func batchByTokens(texts []string, limit int) [][]int {
+	var batches [][]int
+	var current []int
+	size := 0
+	for i, text := range texts {
+		tokens := estimateTokens(text)
+		if len(current) > 0 && size+tokens > limit {
+			batches = append(batches, current)
+			current, size = nil, 0
+		}
+		current = append(current, i)
+		size += tokens
+	}
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+	return batches
+}
+
+func pairUp(n int) [][]int {
+	var pairs [][]int
+	for i := 0; i < n; i += 2 {
+		if i+1 < n {
+			pairs = append(pairs, []int{i, i + 1})
+		} else {
+			pairs = append(pairs, []int{i})
+		}
+	}
+	return pairs
+}
+
+func (mp *MediaProcessor) batchTokenLimit() int {
+	if mp.BatchTokenLimit > 0 {
+		return mp.BatchTokenLimit
+	}
+	return DefaultBatchTokenLimit
+}
+
+func (mp *MediaProcessor) maxParallel() int {
+	if mp.MaxParallel > 0 {
+		return mp.MaxParallel
+	}
+	return DefaultMaxParallel
+}
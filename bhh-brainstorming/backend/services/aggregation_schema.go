@@ -0,0 +1,66 @@
+package services
+
+import "sort"
+
+// ideaIDPrefix starts the message that introduces each idea to the model,
+// so themes can refer back to ideas by ID.
+const ideaIDPrefix = "Idea ID: "
+
+// guidingQuestionPrefix marks the guiding question an idea was tagged with.
+const guidingQuestionPrefix = "Answers guiding question "
+
+// partialAggregationPrefix starts each partial result sent to be merged.
+const partialAggregationPrefix = "Partial aggregation:\n"
+
+// aggregationSchema mirrors models.Aggregation. It follows the strict
+// structured-output rules: every property is required and no others are
+// allowed.
+var aggregationSchema = &ResponseSchema{
+	Name: "idea_aggregation",
+	Schema: object(map[string]interface{}{
+		"summary": stringType(),
+		"themes": arrayOf(object(map[string]interface{}{
+			"title":   stringType(),
+			"summary": stringType(),
+			"ideaIds": arrayOf(stringType()),
+			"pros":    arrayOf(stringType()),
+			"cons":    arrayOf(stringType()),
+		})),
+		"openQuestions": arrayOf(stringType()),
+		"actionItems":   arrayOf(stringType()),
+		"sections": arrayOf(object(map[string]interface{}{
+			"question": integerType(),
+			"summary":  stringType(),
+		})),
+		"suggestions": arrayOf(object(map[string]interface{}{
+			"ideaId":   stringType(),
+			"question": integerType(),
+		})),
+	}),
+}
+
+func object(properties map[string]interface{}) map[string]interface{} {
+	required := make([]string, 0, len(properties))
+	for name := range properties {
+		required = append(required, name)
+	}
+	sort.Strings(required)
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+func arrayOf(items map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"type": "array", "items": items}
+}
+
+func stringType() map[string]interface{} {
+	return map[string]interface{}{"type": "string"}
+}
+
+func integerType() map[string]interface{} {
+	return map[string]interface{}{"type": "integer"}
+}
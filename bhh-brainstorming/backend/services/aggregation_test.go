@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"bhh-brainstorming/backend/models"
+)
+
+func newFakeMediaProcessor(t *testing.T) *MediaProcessor {
+	t.Helper()
+	mp := NewMediaProcessor(NewFakeProvider(), nil)
+	prompts, err := LoadPromptLibrary("")
+	if err != nil {
+		t.Fatalf("loading prompt templates: %v", err)
+	}
+	mp.Prompts = prompts
+	return mp
+}
+
+func TestAggregateMediaWithoutIdeas(t *testing.T) {
+	mp := newFakeMediaProcessor(t)
+	for _, items := range [][]MediaItem{nil, {}} {
+		result, err := mp.AggregateMedia(context.Background(), items, AggregationConfig{}, AggregationHooks{})
+		if !errors.Is(err, ErrNoIdeas) {
+			t.Fatalf("AggregateMedia(%v) error = %v, want ErrNoIdeas", items, err)
+		}
+		if result != nil {
+			t.Fatalf("AggregateMedia(%v) = %+v, want no result", items, result)
+		}
+	}
+}
+
+func TestAggregateMediaTextIdeas(t *testing.T) {
+	mp := newFakeMediaProcessor(t)
+	items := []MediaItem{
+		{ID: "a", MediaType: "text", Content: "Plant trees on the roof"},
+		{ID: "b", MediaType: "text", Content: "Share bikes between teams"},
+	}
+	result, err := mp.AggregateMedia(context.Background(), items, AggregationConfig{}, AggregationHooks{})
+	if err != nil {
+		t.Fatalf("AggregateMedia: %v", err)
+	}
+	if len(result.IdeaIDs) != len(items) {
+		t.Fatalf("aggregation covers ideas %v, want both", result.IdeaIDs)
+	}
+}
+
+// themelessProvider answers every aggregation request without themes,
+// suggesting a guiding question for each idea the request mentions.
+type themelessProvider struct{}
+
+func (themelessProvider) ModelID(model string) string {
+	return model
+}
+
+func (p themelessProvider) Stream(ctx context.Context, request APIRequest, onDelta func(string)) (Completion, error) {
+	return p.Complete(ctx, request)
+}
+
+func (themelessProvider) Complete(ctx context.Context, request APIRequest) (Completion, error) {
+	suggestions := []models.QuestionSuggestion{}
+	for _, msg := range request.Messages {
+		text := msg.Content.PromptText()
+		switch {
+		case strings.HasPrefix(text, ideaIDPrefix):
+			id, _, _ := strings.Cut(strings.TrimPrefix(text, ideaIDPrefix), "\n")
+			suggestions = append(suggestions, models.QuestionSuggestion{IdeaID: id, Question: 1})
+		case strings.HasPrefix(text, partialAggregationPrefix):
+			var partial models.Aggregation
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(text, partialAggregationPrefix)), &partial); err != nil {
+				return Completion{}, err
+			}
+			suggestions = append(suggestions, partial.Suggestions...)
+		}
+	}
+	reply, err := json.Marshal(map[string]interface{}{
+		"summary":       "Ideas without a common theme",
+		"themes":        []models.Theme{},
+		"openQuestions": []string{},
+		"actionItems":   []string{},
+		"suggestions":   suggestions,
+	})
+	return Completion{Content: string(reply), Model: request.Model}, err
+}
+
+func TestAggregateMediaMergesPartialsWithoutThemes(t *testing.T) {
+	mp := newFakeMediaProcessor(t)
+	mp.Provider = themelessProvider{}
+	// Small enough that every idea is summarized in a batch of its own
+	mp.BatchTokenLimit = 20
+	items := []MediaItem{
+		{ID: "a", MediaType: "text", Content: "Plant trees on the roof"},
+		{ID: "b", MediaType: "text", Content: "Share bikes between teams"},
+		{ID: "c", MediaType: "text", Content: "Hold meetings outside"},
+	}
+	config := AggregationConfig{Session: PromptData{Name: "Office", GuidingQuestions: []string{"How can we be greener?"}}}
+	result, err := mp.AggregateMedia(context.Background(), items, config, AggregationHooks{})
+	if err != nil {
+		t.Fatalf("AggregateMedia: %v", err)
+	}
+	if len(result.Suggestions) != len(items) {
+		t.Fatalf("aggregation suggests questions for %v, want every idea", result.Suggestions)
+	}
+}
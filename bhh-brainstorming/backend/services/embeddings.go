@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// DefaultEmbeddingModel is the OpenAI model ideas are embedded with.
+const DefaultEmbeddingModel = openai.EmbeddingModelTextEmbedding3Small
+
+// Embeddings are the vectors of a batch of texts, in input order, and what
+// computing them cost.
+type Embeddings struct {
+	Vectors [][]float32
+	Model   string
+	Usage   Usage
+}
+
+// SimilarityThresholds are the cosine similarities above which two ideas
+// count as possible duplicates, and above which groups of ideas are merged
+// into one cluster. They depend on the embedding model.
+type SimilarityThresholds struct {
+	Duplicate float64
+	Cluster   float64
+}
+
+// Embedder turns texts into vectors whose cosine similarity reflects how
+// close their meanings are. ModelID names the model, like
+// Transcriber.ModelID; vectors of different models cannot be compared.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) (Embeddings, error)
+	ModelID() string
+	Thresholds() SimilarityThresholds
+}
+
+// OpenAIEmbedder embeds texts with OpenAI's embeddings API.
+type OpenAIEmbedder struct {
+	OpenAIKey string
+	Model     string
+}
+
+func NewOpenAIEmbedder(openAIKey string) *OpenAIEmbedder {
+	return &OpenAIEmbedder{OpenAIKey: openAIKey, Model: DefaultEmbeddingModel}
+}
+
+func (e *OpenAIEmbedder) ModelID() string {
+	return "openai/" + e.Model
+}
+
+// Thresholds suit the text-embedding-3 models, whose paraphrases score
+// above 0.85 and texts on a shared topic around 0.5.
+func (e *OpenAIEmbedder) Thresholds() SimilarityThresholds {
+	return SimilarityThresholds{Duplicate: 0.85, Cluster: 0.45}
+}
+
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) (Embeddings, error) {
+	client := openai.NewClient(
+		option.WithAPIKey(e.OpenAIKey),
+	)
+	response, err := client.Embeddings.New(ctx, openai.EmbeddingNewParams{
+		Input: openai.EmbeddingNewParamsInputUnion{OfArrayOfStrings: texts},
+		Model: e.Model,
+	})
+	if err != nil {
+		return Embeddings{}, err
+	}
+	if len(response.Data) != len(texts) {
+		return Embeddings{}, fmt.Errorf("got %d embeddings for %d texts", len(response.Data), len(texts))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, embedding := range response.Data {
+		if embedding.Index < 0 || int(embedding.Index) >= len(texts) {
+			return Embeddings{}, fmt.Errorf("embedding index %d out of range", embedding.Index)
+		}
+		vector := make([]float32, len(embedding.Embedding))
+		for i, value := range embedding.Embedding {
+			vector[i] = float32(value)
+		}
+		vectors[embedding.Index] = vector
+	}
+	return Embeddings{
+		Vectors: vectors,
+		Model:   response.Model,
+		Usage:   Usage{PromptTokens: int(response.Usage.PromptTokens)},
+	}, nil
+}
+
+// hashingDimensions is the length of HashingEmbedder vectors.
+const hashingDimensions = 1024
+
+// HashingEmbedder is an offline Embedder. It hashes the words and word
+// pairs of a text into a fixed number of buckets, so it only recognizes
+// ideas that share wording, not ones that share meaning.
+type HashingEmbedder struct{}
+
+func NewHashingEmbedder() *HashingEmbedder {
+	return &HashingEmbedder{}
+}
+
+func (e *HashingEmbedder) ModelID() string {
+	return fmt.Sprintf("hashing-%d", hashingDimensions)
+}
+
+// Thresholds suit texts that only overlap in wording: a reworded idea
+// shares around two thirds of its words and word pairs.
+func (e *HashingEmbedder) Thresholds() SimilarityThresholds {
+	return SimilarityThresholds{Duplicate: 0.6, Cluster: 0.2}
+}
+
+func (e *HashingEmbedder) Embed(ctx context.Context, texts []string) (Embeddings, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = hashTerms(text)
+	}
+	return Embeddings{Vectors: vectors, Model: e.ModelID()}, nil
+}
+
+// hashTerms builds the normalized vector of a text. Term counts are damped
+// logarithmically, and each term hashes to a bucket and a sign so that
+// collisions tend to cancel out rather than add up.
+func hashTerms(text string) []float32 {
+	counts := map[string]int{}
+	words := terms(text)
+	for i, word := range words {
+		counts[word]++
+		if i > 0 {
+			counts[words[i-1]+" "+word]++
+		}
+	}
+
+	vector := make([]float32, hashingDimensions)
+	for term, count := range counts {
+		hash := fnv.New64a()
+		hash.Write([]byte(term))
+		sum := hash.Sum64()
+		weight := float32(1 + math.Log(float64(count)))
+		if sum&(1<<63) != 0 {
+			weight = -weight
+		}
+		vector[sum%hashingDimensions] += weight
+	}
+	normalize(vector)
+	return vector
+}
+
+// stopWords carry no meaning of their own and are left out of terms.
+var stopWords = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(`a about all also an and any are as at be because been but by can
+		could do does for from get had has have how i if in into is it its just let like make more
+		most much my no not of on or our out so some should than that the their them then there these
+		they this those to too up us use very was we were what when where which while who why will
+		with would you your`) {
+		stopWords[word] = true
+	}
+}
+
+// terms splits a text into lowercase words without stop words. A plural
+// "s" is dropped so "bike" and "bikes" count as the same term.
+func terms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	kept := words[:0]
+	for _, word := range words {
+		if len([]rune(word)) < 2 || stopWords[word] {
+			continue
+		}
+		if len(word) > 3 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") {
+			word = strings.TrimSuffix(word, "s")
+		}
+		kept = append(kept, word)
+	}
+	return kept
+}
+
+func normalize(vector []float32) {
+	var sum float64
+	for _, value := range vector {
+		sum += float64(value) * float64(value)
+	}
+	if sum == 0 {
+		return
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range vector {
+		vector[i] /= norm
+	}
+}
+
+// CosineSimilarity compares two vectors of the same model, from -1 to 1.
+// Empty or zero vectors are similar to nothing.
+func CosineSimilarity(a []float32, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"bhh-brainstorming/backend/models"
+)
+
+// FakeProvider is an offline LLMProvider whose replies depend only on the
+// request, so aggregation can run without a network or an API key.
+type FakeProvider struct{}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{}
+}
+
+func (f *FakeProvider) ModelID(model string) string {
+	return "fake/" + model
+}
+
+func (f *FakeProvider) Complete(ctx context.Context, request APIRequest) (Completion, error) {
+	if err := ctx.Err(); err != nil {
+		return Completion{}, err
+	}
+
+	lines := []string{}
+	promptTokens := 0
+	digest := sha256.New()
+	digest.Write([]byte(request.Model))
+	for _, msg := range request.Messages {
+		text := msg.Content.PromptText()
+		digest.Write([]byte(msg.Role + "\x00" + text + "\x00"))
+		promptTokens += estimateTokens(text)
+		if msg.Role == "system" {
+			continue
+		}
+		if i := strings.IndexByte(text, '\n'); i >= 0 && strings.HasPrefix(text, ideaIDPrefix) {
+			text = text[i+1:]
+		}
+		lines = append(lines, "- "+firstLine(text))
+	}
+
+	content := "Fake summary (" + request.Model + ", " + hex.EncodeToString(digest.Sum(nil))[:8] + ")\n" +
+		strings.Join(lines, "\n")
+	if request.ResponseSchema == nudgeSchema {
+		structured, err := fakeNudges(request.Messages)
+		if err != nil {
+			return Completion{}, err
+		}
+		content = structured
+	} else if request.ResponseSchema != nil {
+		structured, err := fakeAggregation(content, request.Messages)
+		if err != nil {
+			return Completion{}, err
+		}
+		content = structured
+	}
+	// Token counts are estimated so that usage accounting has numbers to show
+	usage := Usage{PromptTokens: promptTokens, CompletionTokens: estimateTokens(content)}
+	return Completion{Content: content, Model: request.Model, Usage: usage}, nil
+}
+
+// fakeAggregation wraps the plain fake reply in the aggregation schema,
+// putting every idea into a single theme and suggesting the first guiding
+// question for every untagged idea.
+func fakeAggregation(summary string, messages []Message) (string, error) {
+	theme := map[string]interface{}{
+		"title":   "All ideas",
+		"summary": "Every submitted idea.",
+		"ideaIds": []string{},
+		"pros":    []string{},
+		"cons":    []string{},
+	}
+	ideaIDs := []string{}
+	suggestions := []models.QuestionSuggestion{}
+	for _, msg := range messages {
+		text := msg.Content.PromptText()
+		if strings.HasPrefix(text, ideaIDPrefix) {
+			id := strings.TrimPrefix(firstLine(text), ideaIDPrefix)
+			ideaIDs = append(ideaIDs, id)
+			if !strings.Contains(text, "\n"+guidingQuestionPrefix) {
+				suggestions = append(suggestions, models.QuestionSuggestion{IdeaID: id, Question: 1})
+			}
+		}
+		// Partial aggregations being merged carry their ideas in their themes
+		if partial, found := strings.CutPrefix(text, partialAggregationPrefix); found {
+			var aggregation models.Aggregation
+			if err := json.Unmarshal([]byte(partial), &aggregation); err != nil {
+				return "", err
+			}
+			for _, theme := range aggregation.Themes {
+				ideaIDs = append(ideaIDs, theme.IdeaIDs...)
+			}
+		}
+	}
+	theme["ideaIds"] = ideaIDs
+	reply, err := json.Marshal(map[string]interface{}{
+		"summary":       summary,
+		"themes":        []interface{}{theme},
+		"openQuestions": []string{},
+		"actionItems":   []string{},
+		"sections": []models.QuestionSection{
+			{Question: 0, Summary: "Ideas that answer no guiding question."},
+		},
+		"suggestions": suggestions,
+	})
+	return string(reply), err
+}
+
+// fakeNudges suggests substituting part of the newest idea that is not the
+// requester's own, plus a nudge towards the first guiding question.
+func fakeNudges(messages []Message) (string, error) {
+	nudges := []Nudge{{Technique: "focus", Text: "What would a completely different answer to the first guiding question look like?", GuidingQuestion: 1}}
+	for i := len(messages) - 1; i >= 0; i-- {
+		text := messages[i].Content.PromptText()
+		id, found := strings.CutPrefix(firstLine(text), ideaIDPrefix)
+		if !found || strings.HasSuffix(id, yourIdeaMarker) {
+			continue
+		}
+		nudges = append([]Nudge{{Technique: "substitute", Text: "What could replace the main ingredient of this idea?", IdeaID: id}}, nudges...)
+		break
+	}
+	reply, err := json.Marshal(map[string]interface{}{"nudges": nudges})
+	return string(reply), err
+}
+
+func firstLine(text string) string {
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		return text[:i]
+	}
+	return text
+}
+
+// Stream delivers the same reply as Complete, one word at a time.
+func (f *FakeProvider) Stream(ctx context.Context, request APIRequest, onDelta func(delta string)) (Completion, error) {
+	completion, err := f.Complete(ctx, request)
+	if err != nil {
+		return Completion{}, err
+	}
+	words := strings.SplitAfter(completion.Content, " ")
+	for _, word := range words {
+		if err := ctx.Err(); err != nil {
+			return Completion{}, err
+		}
+		onDelta(word)
+	}
+	return completion, nil
+}
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"bhh-brainstorming/backend/models"
+)
+
+// embeddingVersion is part of the key of every stored vector. Bump it when
+// EmbeddingText changes so ideas are embedded again.
+const embeddingVersion = "1"
+
+// embeddingBatchSize caps the number of texts embedded in one request.
+const embeddingBatchSize = 256
+
+// maxDuplicates caps the possible duplicates reported for one idea.
+const maxDuplicates = 5
+
+// Duplicate is an existing idea that a new one closely resembles.
+type Duplicate struct {
+	IdeaID     string  `json:"ideaId"`
+	Similarity float64 `json:"similarity"`
+}
+
+// IdeaIndex compares ideas by their embeddings. Vectors are kept in memory,
+// backed by an optional persistent store, keyed by the idea's text and the
+// model, so an idea is only embedded again when its text changes.
+type IdeaIndex struct {
+	Embedder Embedder
+	Store    models.EmbeddingStore
+	vectors  map[models.EmbeddingKey][]float32
+	mutex    sync.RWMutex
+}
+
+func NewIdeaIndex(embedder Embedder) *IdeaIndex {
+	return &IdeaIndex{
+		Embedder: embedder,
+		vectors:  make(map[models.EmbeddingKey][]float32),
+	}
+}
+
+// EmbeddingText is what an idea is compared by: its text plus whatever was
+// extracted from its media so far.
+func EmbeddingText(idea models.Idea) string {
+	parts := []string{idea.Content}
+	for _, extra := range []string{idea.Transcript, idea.Description} {
+		if extra != "" {
+			parts = append(parts, extra)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// Vectors returns the embedding of each idea, embedding those not cached
+// yet in batches.
+func (x *IdeaIndex) Vectors(ctx context.Context, ideas []models.Idea) ([][]float32, error) {
+	vectors := make([][]float32, len(ideas))
+	texts := make([]string, len(ideas))
+	var missing []int
+	for i, idea := range ideas {
+		texts[i] = EmbeddingText(idea)
+		if vector, found := x.load(x.key(texts[i])); found {
+			vectors[i] = vector
+			continue
+		}
+		missing = append(missing, i)
+	}
+
+	for start := 0; start < len(missing); start += embeddingBatchSize {
+		batch := missing[start:min(start+embeddingBatchSize, len(missing))]
+		batchTexts := make([]string, len(batch))
+		for j, i := range batch {
+			batchTexts[j] = texts[i]
+		}
+		embeddings, err := x.Embedder.Embed(ctx, batchTexts)
+		if err != nil {
+			return nil, err
+		}
+		if len(embeddings.Vectors) != len(batch) {
+			return nil, fmt.Errorf("got %d embeddings for %d texts", len(embeddings.Vectors), len(batch))
+		}
+		for j, i := range batch {
+			vectors[i] = embeddings.Vectors[j]
+			x.save(x.key(texts[i]), vectors[i])
+		}
+	}
+	return vectors, nil
+}
+
+func (x *IdeaIndex) key(text string) models.EmbeddingKey {
+	digest := sha256.Sum256([]byte(text))
+	return models.EmbeddingKey{
+		TextHash: hex.EncodeToString(digest[:]),
+		Model:    x.Embedder.ModelID(),
+		Version:  embeddingVersion,
+	}
+}
+
+func (x *IdeaIndex) load(key models.EmbeddingKey) ([]float32, bool) {
+	x.mutex.RLock()
+	vector, found := x.vectors[key]
+	x.mutex.RUnlock()
+	if found || x.Store == nil {
+		return vector, found
+	}
+
+	vector, found, err := x.Store.LoadEmbedding(key)
+	if err != nil {
+		log.Printf("Error reading embedding: %v", err)
+		return nil, false
+	}
+	if found {
+		x.mutex.Lock()
+		x.vectors[key] = vector
+		x.mutex.Unlock()
+	}
+	return vector, found
+}
+
+// save records a vector. Store errors are logged; the vector still lives
+// in memory.
+func (x *IdeaIndex) save(key models.EmbeddingKey, vector []float32) {
+	x.mutex.Lock()
+	x.vectors[key] = vector
+	x.mutex.Unlock()
+	if x.Store != nil {
+		if err := x.Store.SaveEmbedding(key, vector); err != nil {
+			log.Printf("Error saving embedding: %v", err)
+		}
+	}
+}
+
+// Duplicates returns the ideas among others that idea closely resembles,
+// most similar first.
+func (x *IdeaIndex) Duplicates(ctx context.Context, idea models.Idea, others []models.Idea) ([]Duplicate, error) {
+	vectors, err := x.Vectors(ctx, append([]models.Idea{idea}, others...))
+	if err != nil {
+		return nil, err
+	}
+	threshold := x.Embedder.Thresholds().Duplicate
+	duplicates := []Duplicate{}
+	for i, other := range others {
+		if other.ID == idea.ID {
+			continue
+		}
+		if similarity := CosineSimilarity(vectors[0], vectors[i+1]); similarity >= threshold {
+			duplicates = append(duplicates, Duplicate{IdeaID: other.ID, Similarity: similarity})
+		}
+	}
+	sort.SliceStable(duplicates, func(i, j int) bool { return duplicates[i].Similarity > duplicates[j].Similarity })
+	if len(duplicates) > maxDuplicates {
+		duplicates = duplicates[:maxDuplicates]
+	}
+	return duplicates, nil
+}
+
+// Cluster groups the ideas by similarity and labels each group. Ideas
+// unlike any other end up in a cluster of their own.
+func (x *IdeaIndex) Cluster(ctx context.Context, ideas []models.Idea) (models.IdeaClustering, error) {
+	vectors, err := x.Vectors(ctx, ideas)
+	if err != nil {
+		return models.IdeaClustering{}, err
+	}
+	groups := clusterVectors(vectors, x.Embedder.Thresholds().Cluster)
+
+	texts := make([]string, len(ideas))
+	for i, idea := range ideas {
+		texts[i] = EmbeddingText(idea)
+	}
+	labels := labelClusters(texts, groups)
+
+	clusters := make([]models.IdeaCluster, len(groups))
+	for g, group := range groups {
+		clusters[g] = models.IdeaCluster{Label: labels[g], IdeaIDs: make([]string, len(group))}
+		for j, i := range group {
+			clusters[g].IdeaIDs[j] = ideas[i].ID
+		}
+	}
+	return models.IdeaClustering{
+		Clusters:  clusters,
+		Model:     x.Embedder.ModelID(),
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// clusterVectors groups vectors by average-linkage agglomerative
+// clustering: the two most similar groups are merged until no two groups
+// are, on average, at least threshold similar. Groups are returned largest
+// first, each holding indexes into vectors in ascending order.
+func clusterVectors(vectors [][]float32, threshold float64) [][]int {
+	n := len(vectors)
+	groups := make([][]int, n)
+	similarity := make([][]float64, n)
+	for i := range vectors {
+		groups[i] = []int{i}
+		similarity[i] = make([]float64, n)
+	}
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			similarity[i][j] = CosineSimilarity(vectors[i], vectors[j])
+			similarity[j][i] = similarity[i][j]
+		}
+	}
+
+	for {
+		first, second := -1, -1
+		best := threshold
+		for i := 0; i < n; i++ {
+			if groups[i] == nil {
+				continue
+			}
+			for j := i + 1; j < n; j++ {
+				if groups[j] == nil || similarity[i][j] < best || (first >= 0 && similarity[i][j] == best) {
+					continue
+				}
+				first, second, best = i, j, similarity[i][j]
+			}
+		}
+		if first < 0 {
+			break
+		}
+		// The merged group's similarity to any other is the size-weighted
+		// mean of its parts' similarities to it.
+		sizeFirst, sizeSecond := float64(len(groups[first])), float64(len(groups[second]))
+		for k := range groups {
+			if groups[k] == nil || k == first || k == second {
+				continue
+			}
+			merged := (sizeFirst*similarity[first][k] + sizeSecond*similarity[second][k]) / (sizeFirst + sizeSecond)
+			similarity[first][k] = merged
+			similarity[k][first] = merged
+		}
+		groups[first] = append(groups[first], groups[second]...)
+		groups[second] = nil
+	}
+
+	merged := [][]int{}
+	for _, group := range groups {
+		if group != nil {
+			sort.Ints(group)
+			merged = append(merged, group)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool { return len(merged[i]) > len(merged[j]) })
+	return merged
+}
+
+// labelTerms is the number of terms in a cluster label.
+const labelTerms = 3
+
+// labelClusters names each group after its most distinctive terms by
+// TF-IDF, treating every idea as a document: terms used by many ideas of
+// the group and few ideas outside it score highest.
+func labelClusters(texts []string, groups [][]int) []string {
+	documents := make([]map[string]bool, len(texts))
+	frequency := map[string]int{}
+	for i, text := range texts {
+		documents[i] = map[string]bool{}
+		for _, term := range terms(text) {
+			if !documents[i][term] {
+				documents[i][term] = true
+				frequency[term]++
+			}
+		}
+	}
+
+	labels := make([]string, len(groups))
+	for g, group := range groups {
+		counts := map[string]int{}
+		for _, i := range group {
+			for term := range documents[i] {
+				counts[term]++
+			}
+		}
+		scores := make(map[string]float64, len(counts))
+		candidates := make([]string, 0, len(counts))
+		for term, count := range counts {
+			idf := math.Log(float64(1+len(texts))/float64(1+frequency[term])) + 1
+			scores[term] = float64(count) / float64(len(group)) * idf
+			candidates = append(candidates, term)
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			if scores[candidates[i]] != scores[candidates[j]] {
+				return scores[candidates[i]] > scores[candidates[j]]
+			}
+			return candidates[i] < candidates[j]
+		})
+		if len(candidates) > labelTerms {
+			candidates = candidates[:labelTerms]
+		}
+		labels[g] = strings.Join(candidates, ", ")
+		if labels[g] == "" {
+			labels[g] = "Other"
+		}
+	}
+	return labels
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+// DefaultImageMaxDimension bounds the longest side of images sent to vision
+// models. Larger images cost more tokens without helping much.
+const DefaultImageMaxDimension = 1024
+
+// ImageLoader turns uploaded images into data URLs a vision model can read.
+type ImageLoader struct {
+	MaxDimension int // longest side in pixels; 0 disables downscaling
+}
+
+func NewImageLoader(maxDimension int) *ImageLoader {
+	return &ImageLoader{MaxDimension: maxDimension}
+}
+
+// DataURL reads the image file at path, downscales it if needed and returns
+// it base64-encoded.
+func (l *ImageLoader) DataURL(path string) (string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	img, format, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return "", fmt.Errorf("decoding %s: %w", filepath.Base(path), err)
+	}
+
+	bounds := img.Bounds()
+	if l.MaxDimension > 0 && (bounds.Dx() > l.MaxDimension || bounds.Dy() > l.MaxDimension) {
+		img = downscale(img, l.MaxDimension)
+		var encoded bytes.Buffer
+		switch format {
+		case "png":
+			err = png.Encode(&encoded, img)
+		case "jpeg":
+			err = jpeg.Encode(&encoded, img, &jpeg.Options{Quality: 85})
+		default:
+			err = errors.New("unsupported image format " + format)
+		}
+		if err != nil {
+			return "", err
+		}
+		raw = encoded.Bytes()
+	}
+
+	return "data:image/" + format + ";base64," + base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// downscale shrinks img so its longest side is maxDimension, averaging the
+// source pixels that fall into each destination pixel.
+func downscale(img image.Image, maxDimension int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	newWidth, newHeight := maxDimension, maxDimension
+	if width >= height {
+		newHeight = max(1, height*maxDimension/width)
+	} else {
+		newWidth = max(1, width*maxDimension/height)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
+	for y := 0; y < newHeight; y++ {
+		y0 := bounds.Min.Y + y*height/newHeight
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*height/newHeight)
+		for x := 0; x < newWidth; x++ {
+			x0 := bounds.Min.X + x*width/newWidth
+			x1 := max(x0+1, bounds.Min.X+(x+1)*width/newWidth)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
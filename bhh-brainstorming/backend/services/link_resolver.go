@@ -0,0 +1,262 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"bhh-brainstorming/backend/models"
+)
+
+const (
+	DefaultLinkMaxBytes      = 2 << 20 // 2 MB of HTML
+	DefaultLinkMaxTextLength = 4000    // bytes of page text kept for aggregation
+	linkTimeout              = 10 * time.Second
+	linkMaxRedirects         = 5
+)
+
+var ErrBlockedAddress = errors.New("link points to a private or local address")
+
+// blockedPrefixes are ranges net/netip does not already classify as private,
+// loopback, link-local or multicast but that must not be fetched either.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// LinkResolver fetches the pages behind link ideas. The default client
+// refuses to connect to private addresses, so ideas cannot be used to probe
+// the server's network; tests can swap in the client of an httptest.Server.
+type LinkResolver struct {
+	Client        *http.Client
+	MaxBytes      int64
+	MaxTextLength int
+}
+
+func NewLinkResolver() *LinkResolver {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: blockPrivateAddresses,
+	}
+	transport := &http.Transport{
+		// A proxy would make the dial check see the proxy's address instead
+		// of the target's.
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: linkTimeout,
+	}
+	return &LinkResolver{
+		Client: &http.Client{
+			Transport:     transport,
+			Timeout:       linkTimeout,
+			CheckRedirect: checkLinkRedirect,
+		},
+		MaxBytes:      DefaultLinkMaxBytes,
+		MaxTextLength: DefaultLinkMaxTextLength,
+	}
+}
+
+// blockPrivateAddresses runs after DNS resolution, for every connection
+// including redirects, so hostnames resolving to internal IPs are caught.
+func blockPrivateAddresses(network string, address string, conn syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return ErrBlockedAddress
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(ip) {
+			return ErrBlockedAddress
+		}
+	}
+	return nil
+}
+
+func checkLinkRedirect(request *http.Request, via []*http.Request) error {
+	if len(via) >= linkMaxRedirects {
+		return errors.New("too many redirects")
+	}
+	if request.URL.Scheme != "http" && request.URL.Scheme != "https" {
+		return fmt.Errorf("redirect to unsupported scheme %q", request.URL.Scheme)
+	}
+	return nil
+}
+
+// Resolve fetches an http(s) URL and extracts its title, OpenGraph metadata
+// and readable text. Only the first MaxBytes of the page are read.
+func (r *LinkResolver) Resolve(ctx context.Context, rawURL string) (*models.LinkMeta, error) {
+	target, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, err
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported link scheme %q", target.Scheme)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "text/html,application/xhtml+xml,text/plain;q=0.9")
+	response, err := r.Client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: response.StatusCode, Message: "fetching link returned " + response.Status}
+	}
+
+	body := io.LimitReader(response.Body, r.MaxBytes)
+	meta := &models.LinkMeta{URL: response.Request.URL.String()}
+	mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/html", "application/xhtml+xml", "":
+		document, err := html.Parse(body)
+		if err != nil {
+			return nil, err
+		}
+		extractPage(document, meta)
+	case "text/plain":
+		raw, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		meta.Text = collapseSpace(string(raw))
+	default:
+		return nil, fmt.Errorf("unsupported link content type %q", mediaType)
+	}
+
+	if len(meta.Text) > r.MaxTextLength {
+		meta.Text = strings.TrimSpace(truncateUTF8(meta.Text, r.MaxTextLength))
+	}
+	return meta, nil
+}
+
+// skippedElements hold no readable text.
+var skippedElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true,
+	"svg": true, "nav": true, "header": true, "footer": true, "form": true,
+}
+
+func extractPage(document *html.Node, meta *models.LinkMeta) {
+	var text strings.Builder
+	var title string
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.ElementNode {
+			switch node.Data {
+			case "title":
+				if node.FirstChild != nil && title == "" {
+					title = node.FirstChild.Data
+				}
+				return
+			case "meta":
+				applyMetaTag(node, meta)
+				return
+			}
+			if skippedElements[node.Data] {
+				return
+			}
+		}
+		if node.Type == html.TextNode {
+			text.WriteString(node.Data)
+			text.WriteString(" ")
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(document)
+
+	// OpenGraph titles are usually cleaner than <title>, which often carries
+	// the site name as well
+	if meta.Title == "" {
+		meta.Title = collapseSpace(title)
+	}
+	meta.Text = collapseSpace(text.String())
+}
+
+func applyMetaTag(node *html.Node, meta *models.LinkMeta) {
+	var key, content string
+	for _, attr := range node.Attr {
+		switch strings.ToLower(attr.Key) {
+		case "property", "name":
+			key = strings.ToLower(attr.Val)
+		case "content":
+			content = collapseSpace(attr.Val)
+		}
+	}
+	switch key {
+	case "og:title":
+		meta.Title = content
+	case "og:description":
+		meta.Description = content
+	case "description":
+		if meta.Description == "" {
+			meta.Description = content
+		}
+	case "og:site_name":
+		meta.SiteName = content
+	case "og:image":
+		meta.Image = content
+	}
+}
+
+func collapseSpace(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// truncateUTF8 cuts text to at most limit bytes without splitting a rune.
+func truncateUTF8(text string, limit int) string {
+	cut := 0
+	for i := range text {
+		if i > limit {
+			break
+		}
+		cut = i
+	}
+	return text[:cut]
+}
+
+// LinkText renders the extracted page as the text sent to the model.
+func LinkText(meta *models.LinkMeta) string {
+	parts := []string{"Link: " + meta.URL}
+	if meta.Title != "" {
+		parts = append(parts, "Title: "+meta.Title)
+	}
+	if meta.SiteName != "" {
+		parts = append(parts, "Site: "+meta.SiteName)
+	}
+	if meta.Description != "" {
+		parts = append(parts, "Description: "+meta.Description)
+	}
+	if meta.Text != "" {
+		parts = append(parts, "Page text: "+meta.Text)
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveLink answers every request with body as contentType.
+func serveLink(t *testing.T, contentType string, body string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// testResolver uses the server's own client, since the default one refuses
+// to connect to the loopback address test servers listen on.
+func testResolver(server *httptest.Server) *LinkResolver {
+	resolver := NewLinkResolver()
+	resolver.Client = server.Client()
+	return resolver
+}
+
+func TestResolveOpenGraph(t *testing.T) {
+	server := serveLink(t, "text/html; charset=utf-8", `<html><head>
+		<title>Green roofs | Example News</title>
+		<meta property="og:title" content="Green roofs">
+		<meta property="og:description" content="Why  roofs should grow plants.">
+		<meta property="og:site_name" content="Example News">
+		<meta property="og:image" content="https://example.com/roof.jpg">
+		<script>var tracking = true;</script>
+	</head><body><nav>Home</nav><p>Plants   keep buildings cool.</p></body></html>`)
+
+	meta, err := testResolver(server).Resolve(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if meta.URL != server.URL {
+		t.Errorf("URL = %q, want %q", meta.URL, server.URL)
+	}
+	if meta.Title != "Green roofs" {
+		t.Errorf("Title = %q, want the OpenGraph title", meta.Title)
+	}
+	if meta.Description != "Why roofs should grow plants." {
+		t.Errorf("Description = %q", meta.Description)
+	}
+	if meta.SiteName != "Example News" || meta.Image != "https://example.com/roof.jpg" {
+		t.Errorf("SiteName = %q, Image = %q", meta.SiteName, meta.Image)
+	}
+	if meta.Text != "Plants keep buildings cool." {
+		t.Errorf("Text = %q, want only the readable body text", meta.Text)
+	}
+}
+
+func TestResolveTitleWithoutOpenGraph(t *testing.T) {
+	server := serveLink(t, "text/html", `<html><head><title>
+		Bike sharing
+	</title><meta name="description" content="Bikes for everyone."></head><body>Ride.</body></html>`)
+
+	meta, err := testResolver(server).Resolve(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if meta.Title != "Bike sharing" {
+		t.Errorf("Title = %q, want the page title", meta.Title)
+	}
+	if meta.Description != "Bikes for everyone." {
+		t.Errorf("Description = %q, want the meta description", meta.Description)
+	}
+}
+
+func TestResolvePlainText(t *testing.T) {
+	server := serveLink(t, "text/plain", "Meet\n\noutside   more often.")
+
+	meta, err := testResolver(server).Resolve(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if meta.Text != "Meet outside more often." || meta.Title != "" {
+		t.Errorf("Title = %q, Text = %q", meta.Title, meta.Text)
+	}
+}
+
+func TestResolveRejectsOtherContentTypes(t *testing.T) {
+	for _, contentType := range []string{"application/pdf", "image/png", "application/json"} {
+		server := serveLink(t, contentType, "%PDF-1.7")
+		if _, err := testResolver(server).Resolve(context.Background(), server.URL); err == nil {
+			t.Errorf("Resolve of %s succeeded, want an error", contentType)
+		}
+	}
+}
+
+func TestResolveRejectsErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(server.Close)
+
+	_, err := testResolver(server).Resolve(context.Background(), server.URL)
+	var status *StatusError
+	if !errors.As(err, &status) || status.StatusCode != http.StatusNotFound {
+		t.Fatalf("Resolve error = %v, want a 404 StatusError", err)
+	}
+}
+
+func TestResolveReadsAtMostMaxBytes(t *testing.T) {
+	server := serveLink(t, "text/plain", strings.Repeat("word ", 1000))
+	resolver := testResolver(server)
+	resolver.MaxBytes = 20
+
+	meta, err := resolver.Resolve(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if meta.Text != "word word word word" {
+		t.Errorf("Text = %q, want only the first 20 bytes", meta.Text)
+	}
+}
+
+func TestResolveTruncatesText(t *testing.T) {
+	server := serveLink(t, "text/html", "<p>"+strings.Repeat("é", 100)+"</p>")
+	resolver := testResolver(server)
+	resolver.MaxTextLength = 11
+
+	meta, err := resolver.Resolve(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	// é takes two bytes, so 11 bytes only hold five whole ones
+	if meta.Text != strings.Repeat("é", 5) {
+		t.Errorf("Text = %q, want five runes", meta.Text)
+	}
+}
+
+func TestResolveTimesOut(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	t.Cleanup(server.Close)
+	resolver := testResolver(server)
+	resolver.Client.Timeout = 100 * time.Millisecond
+
+	started := time.Now()
+	if _, err := resolver.Resolve(context.Background(), server.URL); err == nil {
+		t.Fatalf("Resolve of a hanging server succeeded")
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Fatalf("Resolve took %v, want it to give up after the client timeout", elapsed)
+	}
+}
+
+func TestResolveRefusesLocalAddresses(t *testing.T) {
+	server := serveLink(t, "text/plain", "internal")
+
+	_, err := NewLinkResolver().Resolve(context.Background(), server.URL)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("Resolve error = %v, want ErrBlockedAddress", err)
+	}
+}
+
+func TestResolveRejectsOtherSchemes(t *testing.T) {
+	for _, link := range []string{"file:///etc/passwd", "ftp://example.com/file"} {
+		if _, err := NewLinkResolver().Resolve(context.Background(), link); err == nil {
+			t.Errorf("Resolve(%q) succeeded, want an error", link)
+		}
+	}
+}
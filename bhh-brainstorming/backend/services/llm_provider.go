@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"bhh-brainstorming/backend/handlers"
+)
+
+// LLMProvider sends a chat request to a language model and returns its reply.
+// Stream behaves like Complete but also hands each piece of generated text
+// to onDelta as soon as it arrives. ModelID names the model that actually
+// answers requests for model, qualified by the provider, so cached results
+// from different backends are never mixed up.
+type LLMProvider interface {
+	Complete(ctx context.Context, request APIRequest) (Completion, error)
+	Stream(ctx context.Context, request APIRequest, onDelta func(delta string)) (Completion, error)
+	ModelID(model string) string
+}
+
+// StatusError is returned when a server answers with an HTTP error status.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
+// DefaultMediaModel describes individual images and videos before
+// aggregation.
+const DefaultMediaModel = "gpt-4o-mini"
+
+// Completion is the model's reply to an APIRequest.
+type Completion struct {
+	Content string
+	Model   string
+	Usage   Usage
+}
+
+type APIRequest struct {
+	Model    string
+	Messages []Message
+	// ResponseSchema, when set, asks the model to reply with JSON matching it.
+	ResponseSchema *ResponseSchema
+}
+
+// ResponseSchema names a JSON Schema for structured model output.
+type ResponseSchema struct {
+	Name   string
+	Schema map[string]interface{}
+}
+
+type Message struct {
+	Role    string
+	Content Content
+}
+
+type Content struct {
+	ContentType string
+	Text        string
+	ImageURL    string
+}
+
+func CreateContent(contenttype string, text string, imageurl string) Content {
+	return Content{ContentType: contenttype, Text: text, ImageURL: imageurl}
+}
+func CreateMessage(role string, content Content) Message {
+	return Message{Role: role, Content: content}
+}
+func CreateAPIRequest(model string, mediaType string, mediaURL string) (APIRequest, error) {
+	if handlers.IsAllowedType(mediaType) {
+		content := CreateContent(mediaType, "", mediaURL)
+		message := CreateMessage("user", content)
+		messages := []Message{message}
+		return APIRequest{Model: model, Messages: messages}, nil
+	}
+	return APIRequest{}, errors.New("invalid media type")
+}
+
+// ImagePart returns the URL to attach as an image content part, which is
+// only possible for images given as a data URL or an absolute URL.
+func (c Content) ImagePart() (string, bool) {
+	switch c.ContentType {
+	case "image", "image/jpeg", "image/png":
+	default:
+		return "", false
+	}
+	if strings.HasPrefix(c.ImageURL, "data:image/") ||
+		strings.HasPrefix(c.ImageURL, "https://") || strings.HasPrefix(c.ImageURL, "http://") {
+		return c.ImageURL, true
+	}
+	return "", false
+}
+
+// PromptText renders the content as the plain-text prompt providers send
+// for it. For images that have an ImagePart it is the instruction sent
+// alongside the image, taken from Text when set.
+func (c Content) PromptText() string {
+	switch c.ContentType {
+	case "image", "image/jpeg", "image/png":
+		if _, ok := c.ImagePart(); ok {
+			if c.Text != "" {
+				return c.Text
+			}
+			return "Please describe this image and extract any relevant information from it."
+		}
+		return "Image URL: " + c.ImageURL +
+			"\nPlease describe this image and extract any relevant information from it."
+
+	case "audio", "audio/mp3", "audio/wav", "audio/mpeg":
+		return "Please analyze this audio content at " + c.ImageURL + " and extract key information."
+
+	case "video", "video/mp4":
+		return "Please analyze this video content at " + c.ImageURL + " and extract key information."
+
+	case "text", "text/plain", "text/link":
+		if c.Text == "" && c.ImageURL != "" {
+			return "Please analyze this content: " + c.ImageURL
+		}
+		return c.Text
+
+	default:
+		return "Please analyze this content: " + c.ImageURL
+	}
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bhh-brainstorming/backend/models"
+)
+
+// mediaPromptVersion is part of every cache key. Bump it whenever the
+// per-media prompts or extraction steps change so old results are redone.
+const mediaPromptVersion = "2"
+
+// DefaultLinkCacheTTL is how long the fetched text of a link is reused.
+// Pages change, unlike uploaded files, so links are fetched again later.
+const DefaultLinkCacheTTL = 24 * time.Hour
+
+// MediaCacheKey identifies one processing result: what was processed, as
+// which type, by which model and with which prompts.
+type MediaCacheKey struct {
+	Hash          string
+	MediaType     string
+	Model         string
+	PromptVersion string
+}
+
+func (k MediaCacheKey) String() string {
+	return strings.Join([]string{k.Hash, k.MediaType, k.Model, k.PromptVersion}, "|")
+}
+
+// MediaCache remembers processed media descriptions in memory, backed by an
+// optional persistent store so results survive restarts.
+type MediaCache struct {
+	Store   models.MediaCacheStore
+	entries map[string]mediaCacheEntry
+	mutex   sync.RWMutex
+}
+
+type mediaCacheEntry struct {
+	content string
+	savedAt time.Time
+}
+
+func NewMediaCache(store models.MediaCacheStore) *MediaCache {
+	return &MediaCache{
+		Store:   store,
+		entries: make(map[string]mediaCacheEntry),
+	}
+}
+
+// Get returns a cached result however old it is.
+func (c *MediaCache) Get(key MediaCacheKey) (string, bool) {
+	return c.GetFresh(key, 0)
+}
+
+// GetFresh returns a cached result saved at most maxAge ago. A maxAge of 0
+// accepts any age.
+func (c *MediaCache) GetFresh(key MediaCacheKey, maxAge time.Duration) (string, bool) {
+	c.mutex.RLock()
+	entry, found := c.entries[key.String()]
+	c.mutex.RUnlock()
+	if !found && c.Store != nil {
+		content, savedAt, stored, err := c.Store.LoadCachedMedia(key.String())
+		if err != nil {
+			log.Printf("Error reading media cache: %v", err)
+			return "", false
+		}
+		if stored {
+			entry, found = mediaCacheEntry{content: content, savedAt: savedAt}, true
+			c.mutex.Lock()
+			c.entries[key.String()] = entry
+			c.mutex.Unlock()
+		}
+	}
+	if !found || (maxAge > 0 && time.Since(entry.savedAt) > maxAge) {
+		return "", false
+	}
+	return entry.content, true
+}
+
+// Put records a result. Store errors are logged; the entry still lives in
+// memory.
+func (c *MediaCache) Put(key MediaCacheKey, content string) {
+	c.mutex.Lock()
+	c.entries[key.String()] = mediaCacheEntry{content: content, savedAt: time.Now()}
+	c.mutex.Unlock()
+	if c.Store != nil {
+		if err := c.Store.SaveCachedMedia(key.String(), content); err != nil {
+			log.Printf("Error saving media cache entry: %v", err)
+		}
+	}
+}
+
+// cacheKey builds the key for processing one idea. Uploaded files are
+// hashed by content, so re-uploads of the same file hit the cache; anything
+// else is hashed by its URL and text.
+func (mp *MediaProcessor) cacheKey(mediaType string, mediaURL string, content string) (MediaCacheKey, error) {
+	digest := sha256.New()
+	path, local, err := mp.localMediaPath(mediaURL)
+	if err != nil {
+		return MediaCacheKey{}, err
+	}
+	if local {
+		file, err := os.Open(path)
+		if err != nil {
+			return MediaCacheKey{}, err
+		}
+		defer file.Close()
+		if _, err := io.Copy(digest, file); err != nil {
+			return MediaCacheKey{}, err
+		}
+	} else {
+		digest.Write([]byte(mediaURL + "\x00" + content))
+	}
+
+	return MediaCacheKey{
+		Hash:          hex.EncodeToString(digest.Sum(nil)),
+		MediaType:     mediaType,
+		Model:         mp.processingModel(mediaType),
+		PromptVersion: mediaPromptVersion,
+	}, nil
+}
+
+// processingModel names everything that shapes the result for a media type.
+func (mp *MediaProcessor) processingModel(mediaType string) string {
+	transcriber := "none"
+	if mp.Transcriber != nil {
+		transcriber = mp.Transcriber.ModelID()
+	}
+	switch {
+	case IsAudioType(mediaType):
+		return transcriber
+	case IsVideoType(mediaType):
+		if mp.Video == nil || !mp.Video.Available() {
+			return transcriber + "+no-keyframes"
+		}
+		return mp.Provider.ModelID(mp.MediaModel) + mp.imageSize() + "+" + transcriber
+	case IsLinkType(mediaType):
+		return "link-resolver"
+	default:
+		return mp.Provider.ModelID(mp.MediaModel) + mp.imageSize()
+	}
+}
+
+// imageSize names the size images and keyframes are scaled to before the
+// model sees them, since a different size can change the description.
+func (mp *MediaProcessor) imageSize() string {
+	if mp.Images == nil || mp.Images.MaxDimension <= 0 {
+		return "@full"
+	}
+	return "@" + strconv.Itoa(mp.Images.MaxDimension) + "px"
+}
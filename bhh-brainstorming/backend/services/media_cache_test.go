@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheKeyChangesWithImageProcessing(t *testing.T) {
+	mp := NewMediaProcessor(NewFakeProvider(), nil)
+	key := func() string {
+		t.Helper()
+		k, err := mp.cacheKey("image", "https://example.com/roof.jpg", "")
+		if err != nil {
+			t.Fatalf("cacheKey: %v", err)
+		}
+		return k.String()
+	}
+
+	original := key()
+	mp.Images.MaxDimension = 512
+	resized := key()
+	if resized == original {
+		t.Fatalf("changing the image size kept the cache key %q", original)
+	}
+	mp.Images.MaxDimension = 0
+	full := key()
+	if full == original || full == resized {
+		t.Fatalf("full size images share the cache key %q", full)
+	}
+	mp.MediaModel = "another-model"
+	if other := key(); other == full {
+		t.Fatalf("changing the media model kept the cache key %q", full)
+	}
+}
+
+func TestLinkDescriptionsExpire(t *testing.T) {
+	var page atomic.Value
+	page.Store("First version")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(page.Load().(string)))
+	}))
+	t.Cleanup(server.Close)
+
+	mp := NewMediaProcessor(NewFakeProvider(), nil)
+	mp.Links = testResolver(server)
+	describe := func() string {
+		t.Helper()
+		text, err := mp.ProcessMedia(context.Background(), "link", server.URL, "")
+		if err != nil {
+			t.Fatalf("ProcessMedia: %v", err)
+		}
+		return text
+	}
+
+	first := describe()
+	page.Store("Second version")
+	if cached := describe(); cached != first {
+		t.Fatalf("a fresh link was fetched again: %q", cached)
+	}
+	mp.LinkCacheTTL = time.Nanosecond
+	if refetched := describe(); refetched == first {
+		t.Fatalf("an expired link kept its old text %q", first)
+	}
+}
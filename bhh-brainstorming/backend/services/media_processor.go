@@ -1,23 +1,219 @@
 package services
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"bhh-brainstorming/backend/models"
+)
+
+// MediaItem is one idea handed to the processor for aggregation.
+type MediaItem struct {
+	ID          string
+	MediaType   string
+	MediaURL    string
+	Content     string
+	Transcript  string // already transcribed audio, if any
+	Description string // already described video, if any
+	// GuidingQuestion is the number of the question the idea was tagged
+	// with, 0 if none.
+	GuidingQuestion int
+}
+
 type MediaProcessor struct {
-	OpenAIService *OpenAIService
+	Provider    LLMProvider
+	Images      *ImageLoader
+	Transcriber Transcriber
+	Video       *VideoProcessor
+	Links       *LinkResolver
+	Cache       *MediaCache
+	MediaDir    string // where UploadMediaHandler stores files
+
+	LinkCacheTTL time.Duration // how long a fetched link is reused, 0 for ever
+
+	MediaWorkers int // ideas processed at once
+	MediaRetries int // retries of transient processing errors per idea
+
+	BatchTokenLimit int // estimated tokens per aggregation request
+	MaxParallel     int // aggregation requests in flight at once
+
+	Prompts          *PromptLibrary
+	MediaModel       string   // describes images and video keyframes
+	AggregationModel string   // default for sessions that did not pick one
+	Models           []string // models sessions may pick for aggregation
 }
 
-func NewMediaProcessor(openAIService *OpenAIService) *MediaProcessor {
+func NewMediaProcessor(provider LLMProvider, transcriber Transcriber) *MediaProcessor {
 	return &MediaProcessor{
-		OpenAIService: openAIService,
+		Provider:    provider,
+		Images:      NewImageLoader(DefaultImageMaxDimension),
+		Transcriber: transcriber,
+		Video:       NewVideoProcessor(),
+		Links:       NewLinkResolver(),
+		Cache:       NewMediaCache(nil),
+		MediaDir:    "./media",
+
+		LinkCacheTTL: DefaultLinkCacheTTL,
+
+		MediaWorkers: DefaultMediaWorkers,
+		MediaRetries: DefaultMediaRetries,
+
+		BatchTokenLimit: DefaultBatchTokenLimit,
+		MaxParallel:     DefaultMaxParallel,
+
+		MediaModel:       DefaultMediaModel,
+		AggregationModel: DefaultAggregationModel,
+		Models:           []string{DefaultAggregationModel, DefaultMediaModel},
+	}
+}
+
+// AllowsModel reports whether sessions may aggregate with model.
+func (mp *MediaProcessor) AllowsModel(model string) bool {
+	for _, allowed := range mp.Models {
+		if allowed == model {
+			return true
+		}
+	}
+	return false
+}
+
+func IsAudioType(mediaType string) bool {
+	return mediaType == "audio" || strings.HasPrefix(mediaType, "audio/")
+}
+
+func IsVideoType(mediaType string) bool {
+	return mediaType == "video" || strings.HasPrefix(mediaType, "video/")
+}
+
+func IsLinkType(mediaType string) bool {
+	return mediaType == "link" || mediaType == "text/link"
+}
+
+// LinkURL returns the address of a link idea, which clients send either as
+// the media URL or as the idea's content.
+func LinkURL(mediaURL string, content string) string {
+	if mediaURL != "" {
+		return mediaURL
 	}
+	return strings.TrimSpace(content)
 }
 
-func (mp *MediaProcessor) ProcessMedia(mediaType string, mediaURL string, content string) (string, error) {
-	return mp.OpenAIService.ProcessMedia(mediaType, mediaURL, content)
+// DescribeLink fetches a link idea's page and returns its text for the model
+// together with the extracted metadata.
+func (mp *MediaProcessor) DescribeLink(ctx context.Context, linkURL string) (string, *models.LinkMeta, error) {
+	meta, err := mp.Links.Resolve(ctx, linkURL)
+	if err != nil {
+		return "", nil, err
+	}
+	return LinkText(meta), meta, nil
 }
 
-func (mp *MediaProcessor) AggregateMedia(items []struct {
-	MediaType string
-	MediaURL  string
-	Content   string
-}) (string, error) {
-	return mp.OpenAIService.AggregateMedia(items)
+// localMediaPath maps a /media/ URL to the uploaded file it serves. ok is
+// false for URLs that point elsewhere.
+func (mp *MediaProcessor) localMediaPath(mediaURL string) (path string, ok bool, err error) {
+	if !strings.HasPrefix(mediaURL, "/media/") {
+		return "", false, nil
+	}
+	name := strings.TrimPrefix(mediaURL, "/media/")
+	if name == "" || name != filepath.Base(name) {
+		return "", false, fmt.Errorf("invalid media path %q", mediaURL)
+	}
+	return filepath.Join(mp.MediaDir, name), true, nil
+}
+
+// TranscribeAudio transcribes an uploaded audio file.
+func (mp *MediaProcessor) TranscribeAudio(ctx context.Context, mediaURL string) (string, error) {
+	if mp.Transcriber == nil {
+		return "", errors.New("no transcriber configured")
+	}
+	path, ok, err := mp.localMediaPath(mediaURL)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("audio %q is not an uploaded file", mediaURL)
+	}
+	return mp.Transcriber.Transcribe(ctx, path)
+}
+
+// ProcessMedia turns one idea into text for the model. Results for
+// non-text media are cached, so unchanged ideas are only processed once;
+// links are fetched again once LinkCacheTTL has passed.
+func (mp *MediaProcessor) ProcessMedia(ctx context.Context, mediaType string, mediaURL string, content string) (string, error) {
+	// If it's text type and we have content, use it directly
+	if (mediaType == "text" || mediaType == "text/plain") && content != "" {
+		return content, nil
+	}
+	ctx = withOperation(ctx, OperationMedia)
+
+	key, err := mp.cacheKey(mediaType, mediaURL, content)
+	if err != nil {
+		// The media itself is unreadable, which processing will report
+		return mp.processMedia(ctx, mediaType, mediaURL, content)
+	}
+	maxAge := time.Duration(0)
+	if IsLinkType(mediaType) {
+		maxAge = mp.LinkCacheTTL
+	}
+	if cached, found := mp.Cache.GetFresh(key, maxAge); found {
+		return cached, nil
+	}
+	processed, err := mp.processMedia(ctx, mediaType, mediaURL, content)
+	if err != nil {
+		return "", err
+	}
+	mp.Cache.Put(key, processed)
+	return processed, nil
+}
+
+func (mp *MediaProcessor) processMedia(ctx context.Context, mediaType string, mediaURL string, content string) (string, error) {
+	// Chat models cannot listen to audio, so they get the transcript instead
+	if IsAudioType(mediaType) {
+		return mp.TranscribeAudio(ctx, mediaURL)
+	}
+	if IsVideoType(mediaType) {
+		return mp.DescribeVideo(ctx, mediaURL)
+	}
+	if IsLinkType(mediaType) {
+		text, _, err := mp.DescribeLink(ctx, LinkURL(mediaURL, content))
+		return text, err
+	}
+
+	// Images are sent to the vision model inline, since it cannot reach our
+	// /media/ URLs
+	if mediaType == "image" || mediaType == "image/jpeg" || mediaType == "image/png" {
+		path, ok, err := mp.localMediaPath(mediaURL)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			if mediaURL, err = mp.Images.DataURL(path); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	// Otherwise, proceed with normal processing
+	request, err := CreateAPIRequest(mp.MediaModel, mediaType, mediaURL)
+	if err != nil {
+		return "", err
+	}
+
+	completion, err := mp.Provider.Complete(ctx, request)
+	if err != nil {
+		return "", err
+	}
+
+	return completion.Content, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
 }
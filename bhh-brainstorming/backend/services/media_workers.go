@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/openai/openai-go"
+
+	"bhh-brainstorming/backend/models"
+)
+
+const (
+	// DefaultMediaWorkers is how many ideas are processed at once.
+	DefaultMediaWorkers = 4
+	// DefaultMediaRetries is how often a transient failure is retried.
+	DefaultMediaRetries = 3
+
+	mediaRetryBaseDelay = 500 * time.Millisecond
+	mediaRetryMaxDelay  = 8 * time.Second
+)
+
+// processItems turns every item into the text sent for aggregation, with up
+// to MediaWorkers items in flight. Items that still fail after their retries
+// are left out of texts and reported in failed, in item order. The returned
+// error is only set when ctx ends first.
+func (mp *MediaProcessor) processItems(ctx context.Context, items []MediaItem, hooks AggregationHooks) (texts []string, failed []models.FailedIdea, err error) {
+	results := make([]string, len(items))
+	errs := make([]error, len(items))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	completed := 0
+
+	for w := 0; w < min(mp.mediaWorkers(), len(items)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i], errs[i] = mp.processItem(ctx, items[i])
+
+				mutex.Lock()
+				completed++
+				hooks.stage(AggregationStage{Stage: StageProcess, Completed: completed, Total: len(items)})
+				mutex.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for i := range items {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	texts = make([]string, len(items))
+	for i, item := range items {
+		if errs[i] != nil {
+			log.Printf("Skipping idea %s in aggregation: %v", item.ID, errs[i])
+			failed = append(failed, models.FailedIdea{IdeaID: item.ID, Error: errs[i].Error()})
+			continue
+		}
+		texts[i] = results[i]
+	}
+	return texts, failed, nil
+}
+
+// processItem returns the text for one idea, reusing its transcript or
+// description when the idea already has one.
+func (mp *MediaProcessor) processItem(ctx context.Context, item MediaItem) (string, error) {
+	if item.Description != "" {
+		return item.Description, nil
+	}
+	if item.Transcript != "" {
+		return item.Transcript, nil
+	}
+	return withRetries(ctx, mp.MediaRetries, func() (string, error) {
+		return mp.ProcessMedia(ctx, item.MediaType, item.MediaURL, item.Content)
+	})
+}
+
+// withRetries calls fn until it succeeds, fails permanently or has been
+// retried retries times, waiting exponentially longer between attempts.
+func withRetries(ctx context.Context, retries int, fn func() (string, error)) (string, error) {
+	delay := mediaRetryBaseDelay
+	for attempt := 0; ; attempt++ {
+		result, err := fn()
+		if err == nil || attempt >= retries || !isTransient(err) || ctx.Err() != nil {
+			return result, err
+		}
+
+		// Jitter keeps parallel workers from retrying in lockstep
+		wait := delay/2 + rand.N(delay/2+1)
+		log.Printf("Retrying after %v (attempt %d of %d): %v", wait, attempt+1, retries, err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return "", ctx.Err()
+		}
+		if delay *= 2; delay > mediaRetryMaxDelay {
+			delay = mediaRetryMaxDelay
+		}
+	}
+}
+
+// isTransient reports whether err is worth retrying: rate limits, server
+// errors, timeouts and dropped connections.
+func isTransient(err error) bool {
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		return retryableStatus(apiErr.StatusCode)
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return retryableStatus(statusErr.StatusCode)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func retryableStatus(code int) bool {
+	return code == 408 || code == 429 || code >= 500
+}
+
+func (mp *MediaProcessor) mediaWorkers() int {
+	if mp.MediaWorkers > 0 {
+		return mp.MediaWorkers
+	}
+	return DefaultMediaWorkers
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"bhh-brainstorming/backend/models"
+)
+
+// maxNudges caps the nudges returned for one request.
+const maxNudges = 5
+
+// nudgeTokenLimit bounds the ideas sent along with a nudge request. The
+// newest ideas are kept when a session has more.
+const nudgeTokenLimit = 8000
+
+// yourIdeaMarker follows the ID of the requester's own ideas.
+const yourIdeaMarker = " (yours)"
+
+// Nudge is a suggestion that gets a stuck participant thinking again. It
+// may build on an existing idea or point at one of the guiding questions.
+type Nudge struct {
+	Technique       string `json:"technique"`
+	Text            string `json:"text"`
+	IdeaID          string `json:"ideaId,omitempty"`
+	GuidingQuestion int    `json:"guidingQuestion,omitempty"`
+}
+
+// NudgeRequest asks for nudges for one participant of a session.
+type NudgeRequest struct {
+	Template *PromptTemplate // nil, or without a "nudge" block, means the default template's
+	Session  PromptData
+	Ideas    []models.Idea // submitted so far, oldest first
+	UserID   string        // the participant asking
+}
+
+// nudgeSchema is the structured reply to a nudge request. Strict mode has
+// no optional properties, so an empty ideaId and question 0 mean none.
+var nudgeSchema = &ResponseSchema{
+	Name: "idea_nudges",
+	Schema: object(map[string]interface{}{
+		"nudges": arrayOf(object(map[string]interface{}{
+			"technique":       stringType(),
+			"text":            stringType(),
+			"ideaId":          stringType(),
+			"guidingQuestion": integerType(),
+		})),
+	}),
+}
+
+// GenerateNudges asks the media model for divergent-thinking nudges based on
+// the session's guiding questions and ideas. References to unknown ideas or
+// questions are dropped rather than failing the request.
+func (mp *MediaProcessor) GenerateNudges(ctx context.Context, request NudgeRequest) ([]Nudge, error) {
+	template := request.Template
+	if template == nil || !template.Has("nudge") {
+		var ok bool
+		if template, ok = mp.Prompts.Get(DefaultPromptTemplate); !ok {
+			return nil, fmt.Errorf("no %q prompt template", DefaultPromptTemplate)
+		}
+	}
+	system, err := template.Render("nudge", request.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk back from the newest idea until the token limit is reached
+	entries := []string{}
+	tokens := 0
+	known := make(map[string]bool, len(request.Ideas))
+	for i := len(request.Ideas) - 1; i >= 0; i-- {
+		idea := request.Ideas[i]
+		entry := ideaIDPrefix + idea.ID
+		if idea.SubmittedBy.ID == request.UserID {
+			entry += yourIdeaMarker
+		}
+		entry += "\n"
+		if idea.GuidingQuestion > 0 {
+			entry += guidingQuestionPrefix + strconv.Itoa(idea.GuidingQuestion) + "\n"
+		}
+		entry += EmbeddingText(idea)
+		if tokens += estimateTokens(entry); tokens > nudgeTokenLimit && len(entries) > 0 {
+			break
+		}
+		entries = append(entries, entry)
+		known[idea.ID] = true
+	}
+
+	messages := []Message{CreateMessage("system", Content{ContentType: "text", Text: system})}
+	for i := len(entries) - 1; i >= 0; i-- {
+		messages = append(messages, CreateMessage("user", Content{ContentType: "text", Text: entries[i]}))
+	}
+	instruction := "Suggest up to " + strconv.Itoa(maxNudges) + " nudges for me."
+	if len(entries) == 0 {
+		instruction = "Nobody has submitted an idea yet. " + instruction
+	}
+	messages = append(messages, CreateMessage("user", Content{ContentType: "text", Text: instruction}))
+
+	completion, err := mp.Provider.Complete(withOperation(ctx, OperationNudge), APIRequest{
+		Model:          mp.MediaModel,
+		Messages:       messages,
+		ResponseSchema: nudgeSchema,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var reply struct {
+		Nudges []Nudge `json:"nudges"`
+	}
+	if err := json.Unmarshal([]byte(completion.Content), &reply); err != nil {
+		log.Printf("Rejected nudge reply: %s", completion.Content[:min(len(completion.Content), 500)])
+		return nil, fmt.Errorf("nudge reply is not valid JSON: %w", err)
+	}
+	nudges := []Nudge{}
+	for _, nudge := range reply.Nudges {
+		nudge.Text = strings.TrimSpace(nudge.Text)
+		if nudge.Text == "" {
+			continue
+		}
+		if !known[nudge.IdeaID] {
+			nudge.IdeaID = ""
+		}
+		if nudge.GuidingQuestion < 0 || nudge.GuidingQuestion > len(request.Session.GuidingQuestions) {
+			nudge.GuidingQuestion = 0
+		}
+		nudges = append(nudges, nudge)
+		if len(nudges) == maxNudges {
+			break
+		}
+	}
+	return nudges, nil
+}
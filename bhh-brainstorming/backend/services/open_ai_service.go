@@ -1,222 +1,128 @@
 package services
 
 import (
-	"bhh-brainstorming/backend/handlers"
-
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
 
 	"context"
-	"encoding/json"
 	"errors"
-	"log"
 )
 
+// OpenAIService is the LLMProvider backed by the official OpenAI API.
 type OpenAIService struct {
 	OpenAIKey string
 }
-type APIRequest struct {
-	Model    string
-	Messages []Message
-}
-
-type Message struct {
-	Role    string
-	Content Content
-}
-
-type Content struct {
-	ContentType string
-	Text        string
-	ImageURL    string
-}
 
 func NewOpenAIService(openAIKey string) *OpenAIService {
 	return &OpenAIService{OpenAIKey: openAIKey}
 }
-func CreateContent(contenttype string, text string, imageurl string) Content {
-	return Content{ContentType: contenttype, Text: text, ImageURL: imageurl}
-}
-func CreateMessage(role string, content Content) Message {
-	return Message{Role: role, Content: content}
-}
-func CreateAPIRequest(mediaType string, mediaURL string) (APIRequest, error) {
-	if handlers.IsAllowedType(mediaType) {
-		content := CreateContent(mediaType, "", mediaURL)
-		message := CreateMessage("user", content)
-		messages := []Message{message}
-		model := "gpt-4o-mini"
-		return APIRequest{Model: model, Messages: messages}, nil
-	}
-	return APIRequest{}, errors.New("invalid media type")
+
+func (o *OpenAIService) ModelID(model string) string {
+	return "openai/" + model
 }
 
-func (o *OpenAIService) ProcessMedia(mediaType string, mediaURL string, content string) (string, error) {
-	// If it's text type and we have content, use it directly
-	if (mediaType == "text" || mediaType == "text/plain") && content != "" {
-		return content, nil
-	}
+func (o *OpenAIService) Complete(ctx context.Context, request APIRequest) (Completion, error) {
+	client := openai.NewClient(
+		option.WithAPIKey(o.OpenAIKey),
+	)
 
-	// Otherwise, proceed with normal processing
-	request, err := CreateAPIRequest(mediaType, mediaURL)
-	if err != nil {
-		return "", err
-	}
+	completion, err := client.Chat.Completions.New(ctx, newChatCompletionParams(request))
 
-	response, err := o.callOpenAI(request)
 	if err != nil {
-		return "", err
+		return Completion{}, err
 	}
-
-	var result map[string]string
-	if err := json.Unmarshal(response, &result); err != nil {
-		return "", err
+	if len(completion.Choices) == 0 {
+		return Completion{}, errors.New("openai returned no choices")
 	}
 
-	return result["content"], nil
+	return Completion{
+		Content: completion.Choices[0].Message.Content,
+		Model:   completion.Model,
+		Usage:   openAIUsage(completion.Usage),
+	}, nil
 }
 
-func (o *OpenAIService) AggregateMedia(items []struct {
-	MediaType string
-	MediaURL  string
-	Content   string
-}) (string, error) {
-	systemMessage := CreateMessage("system", Content{
-		ContentType: "text",
-		Text:        "You are tasked with aggregating and summarizing multiple pieces of content across different media types. Provide a comprehensive summary that captures key insights from all sources.",
-	})
-
-	messages := []Message{systemMessage}
-
-	log.Println("Starting to process", len(items), "items for aggregation")
-
-	for i, item := range items {
-		log.Printf("Processing item %d: Type=%s, URL=%s, Content=%s", i, item.MediaType, item.MediaURL, item.Content)
+func (o *OpenAIService) Stream(ctx context.Context, request APIRequest, onDelta func(delta string)) (Completion, error) {
+	client := openai.NewClient(
+		option.WithAPIKey(o.OpenAIKey),
+	)
 
-		content, err := o.ProcessMedia(item.MediaType, item.MediaURL, item.Content)
-		if err != nil {
-			log.Printf("Error processing media item %d: %v", i, err)
-			return "", err
+	params := newChatCompletionParams(request)
+	// The final chunk then reports the usage of the whole stream
+	params.StreamOptions = openai.ChatCompletionStreamOptionsParam{IncludeUsage: openai.Bool(true)}
+	stream := client.Chat.Completions.NewStreaming(ctx, params)
+	defer stream.Close()
+
+	acc := openai.ChatCompletionAccumulator{}
+	for stream.Next() {
+		chunk := stream.Current()
+		acc.AddChunk(chunk)
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			onDelta(chunk.Choices[0].Delta.Content)
 		}
-
-		log.Printf("Processed content for item %d: %s", i, content[:min(len(content), 100)])
-
-		messages = append(messages, CreateMessage("user", Content{
-			ContentType: "text",
-			Text:        "Content from " + item.MediaType + ": " + content,
-		}))
 	}
-
-	log.Printf("Sending %d messages to OpenAI for aggregation", len(messages))
-
-	messages = append(messages, CreateMessage("user", Content{
-		ContentType: "text",
-		Text:        "Please provide a comprehensive summary and analysis that aggregates all the information above.",
-	}))
-
-	request := APIRequest{
-		Model:    "gpt-4o",
-		Messages: messages,
+	if err := stream.Err(); err != nil {
+		return Completion{}, err
 	}
-
-	response, err := o.callOpenAI(request)
-	if err != nil {
-		return "", err
+	if len(acc.Choices) == 0 {
+		return Completion{}, errors.New("openai returned no choices")
 	}
 
-	var result map[string]string
-	if err := json.Unmarshal(response, &result); err != nil {
-		return "", err
-	}
-
-	return result["content"], nil
+	return Completion{
+		Content: acc.Choices[0].Message.Content,
+		Model:   acc.Model,
+		Usage:   openAIUsage(acc.Usage),
+	}, nil
 }
 
-func (o *OpenAIService) callOpenAI(request APIRequest) ([]byte, error) {
-	client := openai.NewClient(
-		option.WithAPIKey(o.OpenAIKey),
-	)
+func openAIUsage(usage openai.CompletionUsage) Usage {
+	return Usage{
+		PromptTokens:     int(usage.PromptTokens),
+		CompletionTokens: int(usage.CompletionTokens),
+	}
+}
 
+func newChatCompletionParams(request APIRequest) openai.ChatCompletionNewParams {
 	messages := []openai.ChatCompletionMessageParamUnion{}
 
 	for _, msg := range request.Messages {
-		switch msg.Content.ContentType {
-		case "image", "image/jpeg", "image/png":
-			messages = append(messages, openai.ChatCompletionMessageParamUnion{
-				OfUser: &openai.ChatCompletionUserMessageParam{
-					Content: openai.ChatCompletionUserMessageParamContentUnion{
-						OfString: openai.String("Image URL: " + msg.Content.ImageURL +
-							"\nPlease describe this image and extract any relevant information from it."),
-					},
-				},
-			})
-
-		case "audio", "audio/mp3", "audio/wav", "audio/mpeg":
-			messages = append(messages, openai.ChatCompletionMessageParamUnion{
-				OfUser: &openai.ChatCompletionUserMessageParam{
-					Content: openai.ChatCompletionUserMessageParamContentUnion{
-						OfString: openai.String("Please analyze this audio content at " +
-							msg.Content.ImageURL + " and extract key information."),
-					},
-				},
-			})
-
-		case "video", "video/mp4":
-			messages = append(messages, openai.ChatCompletionMessageParamUnion{
-				OfUser: &openai.ChatCompletionUserMessageParam{
-					Content: openai.ChatCompletionUserMessageParamContentUnion{
-						OfString: openai.String("Please analyze this video content at " +
-							msg.Content.ImageURL + " and extract key information."),
-					},
+		text := msg.Content.PromptText()
+		if msg.Role == "system" {
+			messages = append(messages, openai.SystemMessage(text))
+			continue
+		}
+		content := openai.ChatCompletionUserMessageParamContentUnion{
+			OfString: openai.String(text),
+		}
+		if imageURL, ok := msg.Content.ImagePart(); ok {
+			content = openai.ChatCompletionUserMessageParamContentUnion{
+				OfArrayOfContentParts: []openai.ChatCompletionContentPartUnionParam{
+					openai.TextContentPart(text),
+					openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{URL: imageURL}),
 				},
-			})
-
-		case "text", "text/plain", "text/link":
-			content := msg.Content.Text
-			if content == "" && msg.Content.ImageURL != "" {
-				content = "Please analyze this content: " + msg.Content.ImageURL
 			}
-
-			messages = append(messages, openai.ChatCompletionMessageParamUnion{
-				OfUser: &openai.ChatCompletionUserMessageParam{
-					Content: openai.ChatCompletionUserMessageParamContentUnion{
-						OfString: openai.String(content),
-					},
-				},
-			})
-
-		default:
-			messages = append(messages, openai.ChatCompletionMessageParamUnion{
-				OfUser: &openai.ChatCompletionUserMessageParam{
-					Content: openai.ChatCompletionUserMessageParamContentUnion{
-						OfString: openai.String("Please analyze this content: " + msg.Content.ImageURL),
-					},
-				},
-			})
 		}
+		messages = append(messages, openai.ChatCompletionMessageParamUnion{
+			OfUser: &openai.ChatCompletionUserMessageParam{
+				Content: content,
+			},
+		})
 	}
 
-	ctx := context.Background()
-
-	completion, err := client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+	params := openai.ChatCompletionNewParams{
 		Model:    request.Model,
 		Messages: messages,
-	})
-
-	if err != nil {
-		return nil, err
 	}
-
-	responseContent := completion.Choices[0].Message.Content
-
-	return json.Marshal(map[string]string{
-		"content": responseContent,
-	})
-}
-
-func min(a, b int) int {
-	if a < b {
-		return a
+	if request.ResponseSchema != nil {
+		params.ResponseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{
+			OfJSONSchema: &openai.ResponseFormatJSONSchemaParam{
+				JSONSchema: openai.ResponseFormatJSONSchemaJSONSchemaParam{
+					Name:   request.ResponseSchema.Name,
+					Schema: request.ResponseSchema.Schema,
+					Strict: openai.Bool(true),
+				},
+			},
+		}
 	}
-	return b
+	return params
 }
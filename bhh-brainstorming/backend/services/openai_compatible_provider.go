@@ -0,0 +1,240 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAICompatibleProvider talks to any server exposing the OpenAI chat
+// completions HTTP API, such as a local model server.
+type OpenAICompatibleProvider struct {
+	BaseURL string // e.g. http://localhost:11434/v1
+	APIKey  string // optional; sent as a bearer token when set
+	Model   string // optional; overrides the model named in each request
+	Client  *http.Client
+}
+
+func NewOpenAICompatibleProvider(baseURL string, apiKey string, model string) *OpenAICompatibleProvider {
+	return &OpenAICompatibleProvider{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		APIKey:  apiKey,
+		Model:   model,
+		Client:  &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+type chatCompletionRequest struct {
+	Model          string           `json:"model"`
+	Messages       []requestMessage `json:"messages"`
+	Stream         bool             `json:"stream,omitempty"`
+	StreamOptions  *streamOptions   `json:"stream_options,omitempty"`
+	ResponseFormat *responseFormat  `json:"response_format,omitempty"`
+}
+
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type responseFormat struct {
+	Type       string `json:"type"`
+	JSONSchema struct {
+		Name   string                 `json:"name"`
+		Schema map[string]interface{} `json:"schema"`
+		Strict bool                   `json:"strict"`
+	} `json:"json_schema"`
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// requestMessage content is either a string or, for images, a list of
+// content parts.
+type requestMessage struct {
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"`
+}
+
+type contentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *imageURL `json:"image_url,omitempty"`
+}
+
+type imageURL struct {
+	URL string `json:"url"`
+}
+
+type chatCompletionResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message chatMessage `json:"message"`
+		Delta   chatMessage `json:"delta"`
+	} `json:"choices"`
+	// Usage is only in the final chunk of a stream, and some servers leave
+	// it out entirely.
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage,omitempty"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func (r chatCompletionResponse) usage() Usage {
+	if r.Usage == nil {
+		return Usage{}
+	}
+	return Usage{PromptTokens: r.Usage.PromptTokens, CompletionTokens: r.Usage.CompletionTokens}
+}
+
+func (p *OpenAICompatibleProvider) ModelID(model string) string {
+	if p.Model != "" {
+		model = p.Model
+	}
+	return p.BaseURL + "/" + model
+}
+
+func (p *OpenAICompatibleProvider) Complete(ctx context.Context, request APIRequest) (Completion, error) {
+	response, err := p.post(ctx, request, false)
+	if err != nil {
+		return Completion{}, err
+	}
+	defer response.Body.Close()
+	raw, err := io.ReadAll(response.Body)
+	if err != nil {
+		return Completion{}, err
+	}
+
+	var parsed chatCompletionResponse
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		return Completion{}, fmt.Errorf("chat completion returned invalid JSON: %w", err)
+	}
+	if len(parsed.Choices) == 0 {
+		return Completion{}, errors.New("chat completion returned no choices")
+	}
+
+	return Completion{
+		Content: parsed.Choices[0].Message.Content,
+		Model:   parsed.Model,
+		Usage:   parsed.usage(),
+	}, nil
+}
+
+// Stream reads the server-sent events of a streamed chat completion.
+func (p *OpenAICompatibleProvider) Stream(ctx context.Context, request APIRequest, onDelta func(delta string)) (Completion, error) {
+	response, err := p.post(ctx, request, true)
+	if err != nil {
+		return Completion{}, err
+	}
+	defer response.Body.Close()
+
+	var content strings.Builder
+	var model string
+	var usage Usage
+	scanner := bufio.NewScanner(response.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+		var chunk chatCompletionResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return Completion{}, fmt.Errorf("chat completion stream returned invalid JSON: %w", err)
+		}
+		if chunk.Error != nil {
+			return Completion{}, errors.New(chunk.Error.Message)
+		}
+		if chunk.Model != "" {
+			model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			usage = chunk.usage()
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			content.WriteString(chunk.Choices[0].Delta.Content)
+			onDelta(chunk.Choices[0].Delta.Content)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Completion{}, err
+	}
+
+	return Completion{Content: content.String(), Model: model, Usage: usage}, nil
+}
+
+// post sends the chat completion request and returns the response once it
+// is known to be successful.
+func (p *OpenAICompatibleProvider) post(ctx context.Context, request APIRequest, stream bool) (*http.Response, error) {
+	body := chatCompletionRequest{Model: request.Model, Stream: stream}
+	if stream {
+		body.StreamOptions = &streamOptions{IncludeUsage: true}
+	}
+	if p.Model != "" {
+		body.Model = p.Model
+	}
+	if request.ResponseSchema != nil {
+		body.ResponseFormat = &responseFormat{Type: "json_schema"}
+		body.ResponseFormat.JSONSchema.Name = request.ResponseSchema.Name
+		body.ResponseFormat.JSONSchema.Schema = request.ResponseSchema.Schema
+		body.ResponseFormat.JSONSchema.Strict = true
+	}
+	for _, msg := range request.Messages {
+		role := msg.Role
+		if role == "" {
+			role = "user"
+		}
+		var content interface{} = msg.Content.PromptText()
+		if url, ok := msg.Content.ImagePart(); ok {
+			content = []contentPart{
+				{Type: "text", Text: msg.Content.PromptText()},
+				{Type: "image_url", ImageURL: &imageURL{URL: url}},
+			}
+		}
+		body.Messages = append(body.Messages, requestMessage{Role: role, Content: content})
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, p.BaseURL+"/chat/completions", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	if p.APIKey != "" {
+		httpRequest.Header.Set("Authorization", "Bearer "+p.APIKey)
+	}
+
+	response, err := p.Client.Do(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		raw, _ := io.ReadAll(io.LimitReader(response.Body, 64*1024))
+		var parsed chatCompletionResponse
+		message := "chat completion returned " + response.Status
+		if json.Unmarshal(raw, &parsed) == nil && parsed.Error != nil {
+			message += ": " + parsed.Error.Message
+		}
+		return nil, &StatusError{StatusCode: response.StatusCode, Message: message}
+	}
+	return response, nil
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"bhh-brainstorming/backend/models"
+)
+
+// DefaultPromptTemplate is used by sessions that did not pick a template.
+const DefaultPromptTemplate = "default"
+
+//go:embed prompts/*.tmpl
+var builtinPrompts embed.FS
+
+// Blocks every prompt template must define. A template may also define
+// "version"; without it the version is derived from the file's contents.
+var promptBlocks = []string{"system", "summarize", "summarize_batch", "reduce"}
+
+// optionalPromptBlocks may be left out of a template; the default
+// template's block is used instead.
+var optionalPromptBlocks = []string{"nudge"}
+
+// promptFuncs are available in every template. inc turns range indexes
+// into the question numbers ideas are tagged with.
+var promptFuncs = template.FuncMap{
+	"inc": func(i int) int { return i + 1 },
+}
+
+// PromptData is what prompt templates can refer to.
+type PromptData struct {
+	Name             string
+	GuidingQuestions []string
+}
+
+// SessionPromptData returns the prompt data of a session.
+func SessionPromptData(session *models.Session) PromptData {
+	return PromptData{Name: session.Name, GuidingQuestions: session.GuidingQuestions}
+}
+
+// PromptTemplate is one named set of aggregation prompts, parsed from a
+// text/template file with one block per prompt.
+type PromptTemplate struct {
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	template *template.Template
+}
+
+// ParsePromptTemplate parses the template source and checks that it
+// defines, and can render, every block.
+func ParsePromptTemplate(name string, source string) (*PromptTemplate, error) {
+	tmpl, err := template.New(name).Funcs(promptFuncs).Option("missingkey=error").Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	prompt := &PromptTemplate{Name: name, template: tmpl}
+	sample := PromptData{Name: "Sample", GuidingQuestions: []string{"Sample question?"}}
+	for _, block := range promptBlocks {
+		if tmpl.Lookup(block) == nil {
+			return nil, fmt.Errorf("prompt template %q has no %q block", name, block)
+		}
+		if _, err := prompt.Render(block, sample); err != nil {
+			return nil, err
+		}
+	}
+	for _, block := range optionalPromptBlocks {
+		if !prompt.Has(block) {
+			continue
+		}
+		if _, err := prompt.Render(block, sample); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmpl.Lookup("version") != nil {
+		if prompt.Version, err = prompt.Render("version", PromptData{}); err != nil {
+			return nil, err
+		}
+	}
+	if prompt.Version == "" {
+		digest := sha256.Sum256([]byte(source))
+		prompt.Version = hex.EncodeToString(digest[:])[:12]
+	}
+	return prompt, nil
+}
+
+// Has reports whether the template defines block.
+func (p *PromptTemplate) Has(block string) bool {
+	return p.template.Lookup(block) != nil
+}
+
+// Render executes one block with the session's data. Surrounding
+// whitespace is trimmed, so blocks can be laid out freely in the file.
+func (p *PromptTemplate) Render(block string, data PromptData) (string, error) {
+	var rendered strings.Builder
+	if err := p.template.ExecuteTemplate(&rendered, block, data); err != nil {
+		return "", fmt.Errorf("prompt template %q: %w", p.Name, err)
+	}
+	return strings.TrimSpace(rendered.String()), nil
+}
+
+// PromptLibrary holds the prompt templates sessions can choose from.
+type PromptLibrary struct {
+	templates map[string]*PromptTemplate
+}
+
+// LoadPromptLibrary loads the built-in templates and then every *.tmpl file
+// in dir, named after the file. Files named like a built-in replace it. An
+// empty dir loads only the built-ins.
+func LoadPromptLibrary(dir string) (*PromptLibrary, error) {
+	library := &PromptLibrary{templates: map[string]*PromptTemplate{}}
+	if err := library.loadFS(builtinPrompts, "prompts/*.tmpl"); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, err
+		}
+		if err := library.loadFS(os.DirFS(dir), "*.tmpl"); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := library.templates[DefaultPromptTemplate]; !ok {
+		return nil, fmt.Errorf("no %q prompt template", DefaultPromptTemplate)
+	}
+	return library, nil
+}
+
+func (l *PromptLibrary) loadFS(fsys fs.FS, pattern string) error {
+	paths, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		source, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ".tmpl")
+		prompt, err := ParsePromptTemplate(name, string(source))
+		if err != nil {
+			return err
+		}
+		l.templates[name] = prompt
+	}
+	return nil
+}
+
+// Get returns the named template; an empty name means the default.
+func (l *PromptLibrary) Get(name string) (*PromptTemplate, bool) {
+	if l == nil {
+		return nil, false
+	}
+	if name == "" {
+		name = DefaultPromptTemplate
+	}
+	prompt, ok := l.templates[name]
+	return prompt, ok
+}
+
+// List returns every template, sorted by name.
+func (l *PromptLibrary) List() []*PromptTemplate {
+	prompts := make([]*PromptTemplate, 0, len(l.templates))
+	for _, prompt := range l.templates {
+		prompts = append(prompts, prompt)
+	}
+	sort.Slice(prompts, func(i, j int) bool { return prompts[i].Name < prompts[j].Name })
+	return prompts
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// summaryStream follows a streamed aggregation reply and passes on only the
+// text of its top-level "summary" field, so listeners read prose instead of
+// fragments of the JSON the response schema asks for.
+type summaryStream struct {
+	onText func(text string)
+
+	depth     int  // nesting of objects and arrays
+	expectKey bool // the next string in the top-level object is a key
+	inString  bool
+	isKey     bool
+	inSummary bool   // inside the value of the top-level summary
+	escape    []byte // unfinished escape sequence, from its backslash
+	high      rune   // high surrogate waiting for its pair
+	key       []byte
+	lastKey   string
+	pending   []byte // summary text not passed on yet
+}
+
+func newSummaryStream(onText func(text string)) *summaryStream {
+	return &summaryStream{onText: onText}
+}
+
+// Write takes the next delta of the reply.
+func (s *summaryStream) Write(delta string) {
+	for i := 0; i < len(delta); i++ {
+		c := delta[i]
+		if s.inString {
+			s.stringByte(c)
+			continue
+		}
+		switch c {
+		case '{', '[':
+			s.depth++
+			if s.depth == 1 {
+				s.expectKey = c == '{'
+			}
+		case '}', ']':
+			s.depth--
+		case ',':
+			if s.depth == 1 {
+				s.expectKey = true
+			}
+		case '"':
+			s.inString = true
+			if s.depth != 1 {
+				break
+			}
+			if s.expectKey {
+				s.isKey = true
+				s.expectKey = false
+				s.key = s.key[:0]
+			} else {
+				s.inSummary = s.lastKey == "summary"
+			}
+		}
+	}
+	s.flush(false)
+}
+
+// stringByte handles one byte inside a string, decoding escapes.
+func (s *summaryStream) stringByte(c byte) {
+	if len(s.escape) > 0 {
+		s.escape = append(s.escape, c)
+		if s.escape[1] == 'u' && len(s.escape) < 6 {
+			return
+		}
+		s.decodeEscape()
+		s.escape = s.escape[:0]
+		return
+	}
+	switch c {
+	case '\\':
+		s.escape = append(s.escape, c)
+	case '"':
+		s.inString = false
+		if s.isKey {
+			s.isKey = false
+			s.lastKey = string(s.key)
+		} else if s.inSummary {
+			s.inSummary = false
+			s.flush(true)
+		}
+	default:
+		s.text([]byte{c})
+	}
+}
+
+func (s *summaryStream) decodeEscape() {
+	switch s.escape[1] {
+	case 'n':
+		s.text([]byte("\n"))
+	case 't':
+		s.text([]byte("\t"))
+	case 'r', 'b', 'f':
+		// Control characters are no use in displayed text
+	case 'u':
+		code, err := strconv.ParseUint(string(s.escape[2:]), 16, 16)
+		if err != nil {
+			return
+		}
+		r := rune(code)
+		if utf16.IsSurrogate(r) {
+			if s.high == 0 {
+				s.high = r
+				return
+			}
+			r = utf16.DecodeRune(s.high, r)
+			s.high = 0
+		}
+		s.text(utf8.AppendRune(nil, r))
+	default:
+		// \" \\ and \/ stand for the character itself
+		s.text(s.escape[1:2])
+	}
+}
+
+func (s *summaryStream) text(b []byte) {
+	if s.isKey {
+		s.key = append(s.key, b...)
+	} else if s.inSummary {
+		s.pending = append(s.pending, b...)
+	}
+}
+
+// flush passes on the pending text. Unless all is set, a character whose
+// bytes have not all arrived yet is held back for the next delta.
+func (s *summaryStream) flush(all bool) {
+	n := len(s.pending)
+	if !all {
+		n = completeRunes(s.pending)
+	}
+	if n == 0 {
+		return
+	}
+	s.onText(string(s.pending[:n]))
+	s.pending = append(s.pending[:0], s.pending[n:]...)
+}
+
+// completeRunes returns the length of the longest prefix of p that does not
+// end in the middle of a UTF-8 sequence.
+func completeRunes(p []byte) int {
+	for i := len(p) - 1; i >= 0 && i >= len(p)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(p[i]) {
+			if utf8.FullRune(p[i:]) {
+				return len(p)
+			}
+			return i
+		}
+	}
+	return len(p)
+}
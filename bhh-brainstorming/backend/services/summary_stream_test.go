@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSummaryStreamPassesOnOnlyTheSummary(t *testing.T) {
+	reply := `{"actionItems":["Ask \"facilities\""],"sections":[{"question":1,"summary":"Not this"}],` +
+		`"summary":"Green \"roofs\" – cafés 🌱\nand bikes","themes":[{"title":"Roofs","summary":"Nor this"}]}`
+	want := "Green \"roofs\" – cafés 🌱\nand bikes"
+
+	// Every split point, including inside escapes and multi-byte characters
+	for size := 1; size <= 7; size++ {
+		var text strings.Builder
+		stream := newSummaryStream(func(delta string) {
+			if !strings.HasPrefix(want[text.Len():], delta) {
+				t.Fatalf("chunks of %d: delta %q does not continue %q", size, delta, text.String())
+			}
+			text.WriteString(delta)
+		})
+		for i := 0; i < len(reply); i += size {
+			stream.Write(reply[i:min(i+size, len(reply))])
+		}
+		if text.String() != want {
+			t.Fatalf("chunks of %d: streamed %q, want %q", size, text.String(), want)
+		}
+	}
+}
+
+func TestAggregateMediaStreamsSummaryText(t *testing.T) {
+	mp := newFakeMediaProcessor(t)
+	items := []MediaItem{
+		{ID: "a", MediaType: "text", Content: "Plant trees on the roof"},
+		{ID: "b", MediaType: "text", Content: "Share bikes between teams"},
+	}
+	var streamed strings.Builder
+	result, err := mp.AggregateMedia(context.Background(), items, AggregationConfig{}, AggregationHooks{
+		OnDelta: func(delta string) { streamed.WriteString(delta) },
+	})
+	if err != nil {
+		t.Fatalf("AggregateMedia: %v", err)
+	}
+	if result.Summary == "" || streamed.String() != result.Summary {
+		t.Fatalf("streamed %q, want the summary %q", streamed.String(), result.Summary)
+	}
+}
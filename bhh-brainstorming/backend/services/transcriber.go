@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// Transcriber turns a stored audio file into text. ModelID names the
+// speech model, like LLMProvider.ModelID.
+type Transcriber interface {
+	Transcribe(ctx context.Context, path string) (string, error)
+	ModelID() string
+}
+
+// WhisperTranscriber transcribes audio with OpenAI's Whisper model.
+type WhisperTranscriber struct {
+	OpenAIKey string
+}
+
+func NewWhisperTranscriber(openAIKey string) *WhisperTranscriber {
+	return &WhisperTranscriber{OpenAIKey: openAIKey}
+}
+
+func (w *WhisperTranscriber) ModelID() string {
+	return "openai/" + openai.AudioModelWhisper1
+}
+
+func (w *WhisperTranscriber) Transcribe(ctx context.Context, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	client := openai.NewClient(
+		option.WithAPIKey(w.OpenAIKey),
+	)
+
+	// The file name is sent along with the upload and tells the API the format
+	transcription, err := client.Audio.Transcriptions.New(ctx, openai.AudioTranscriptionNewParams{
+		File:  file,
+		Model: openai.AudioModelWhisper1,
+	})
+	if err != nil {
+		return "", err
+	}
+	return transcription.Text, nil
+}
+
+// StubTranscriber is an offline Transcriber for development. Its transcript
+// only names the file and a digest of its contents.
+type StubTranscriber struct{}
+
+func NewStubTranscriber() *StubTranscriber {
+	return &StubTranscriber{}
+}
+
+func (s *StubTranscriber) ModelID() string {
+	return "stub"
+}
+
+func (s *StubTranscriber) Transcribe(ctx context.Context, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	digest := sha256.New()
+	if _, err := io.Copy(digest, file); err != nil {
+		return "", err
+	}
+	return "Stub transcript of " + filepath.Base(path) + " (" + hex.EncodeToString(digest.Sum(nil))[:8] + ")", nil
+}
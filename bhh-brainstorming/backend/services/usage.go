@@ -0,0 +1,342 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"bhh-brainstorming/backend/models"
+)
+
+// Operations that model calls are attributed to.
+const (
+	OperationMedia       = "media"       // describing a single idea
+	OperationAggregation = "aggregation" // summarizing and merging ideas
+	OperationEmbedding   = "embedding"   // comparing and clustering ideas
+	OperationNudge       = "nudge"       // prompting stuck participants
+)
+
+var ErrBudgetExceeded = errors.New("the session's AI budget is used up")
+
+// Usage is the number of tokens a model call consumed.
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// UsageScope attributes model calls made with a context to a session.
+// Budget is the session's cap in US dollars; 0 means no cap.
+type UsageScope struct {
+	SessionID string
+	Budget    float64
+}
+
+type usageScopeKey struct{}
+type operationKey struct{}
+
+// WithUsageScope returns a context whose model calls are metered for the
+// scope's session.
+func WithUsageScope(ctx context.Context, scope UsageScope) context.Context {
+	return context.WithValue(ctx, usageScopeKey{}, scope)
+}
+
+func withOperation(ctx context.Context, operation string) context.Context {
+	return context.WithValue(ctx, operationKey{}, operation)
+}
+
+// ModelPrice is what a model costs in US dollars per million tokens.
+type ModelPrice struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// PriceTable maps model names to prices. Keys match model names by prefix,
+// so "gpt-4o" also prices dated snapshots like "gpt-4o-2024-08-06"; the
+// longest matching key wins.
+type PriceTable map[string]ModelPrice
+
+// DefaultPrices are OpenAI's list prices for the models this server uses.
+var DefaultPrices = PriceTable{
+	"gpt-4o":      {Prompt: 2.50, Completion: 10.00},
+	"gpt-4o-mini": {Prompt: 0.15, Completion: 0.60},
+
+	"text-embedding-3-small": {Prompt: 0.02},
+}
+
+// LoadPriceTable reads a JSON price table from path and adds it on top of
+// DefaultPrices.
+func LoadPriceTable(path string) (PriceTable, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var loaded PriceTable
+	if err := json.Unmarshal(raw, &loaded); err != nil {
+		return nil, err
+	}
+	table := PriceTable{}
+	for model, price := range DefaultPrices {
+		table[model] = price
+	}
+	for model, price := range loaded {
+		table[model] = price
+	}
+	return table, nil
+}
+
+// Cost converts token counts into US dollars. ok is false for models the
+// table has no price for.
+func (t PriceTable) Cost(model string, promptTokens int, completionTokens int) (cost float64, ok bool) {
+	match := ""
+	for name := range t {
+		if strings.HasPrefix(model, name) && len(name) > len(match) {
+			match = name
+		}
+	}
+	if match == "" {
+		return 0, false
+	}
+	price := t[match]
+	return (float64(promptTokens)*price.Prompt + float64(completionTokens)*price.Completion) / 1e6, true
+}
+
+// OperationUsage totals the calls of one operation and model.
+type OperationUsage struct {
+	Operation        string  `json:"operation"`
+	Model            string  `json:"model"`
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	Cost             float64 `json:"cost"`
+	Priced           bool    `json:"priced"`
+}
+
+// UsageReport is the token usage and cost of a session.
+type UsageReport struct {
+	SessionID        string           `json:"sessionId"`
+	Operations       []OperationUsage `json:"operations"`
+	PromptTokens     int              `json:"promptTokens"`
+	CompletionTokens int              `json:"completionTokens"`
+	Cost             float64          `json:"cost"`
+}
+
+// UsageMeter records the usage of metered model calls and keeps a running
+// cost per session for budget checks.
+type UsageMeter struct {
+	Store  models.UsageStore
+	Prices PriceTable
+	spent  map[string]float64
+	mutex  sync.Mutex
+}
+
+func NewUsageMeter(store models.UsageStore, prices PriceTable) *UsageMeter {
+	return &UsageMeter{
+		Store:  store,
+		Prices: prices,
+		spent:  make(map[string]float64),
+	}
+}
+
+// Spent returns what the session's model calls have cost so far.
+func (m *UsageMeter) Spent(sessionID string) (float64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.spentLocked(sessionID)
+}
+
+// spentLocked loads a session's total from the store the first time it is
+// needed, so budgets hold across restarts.
+func (m *UsageMeter) spentLocked(sessionID string) (float64, error) {
+	if spent, ok := m.spent[sessionID]; ok {
+		return spent, nil
+	}
+	spent := 0.0
+	if m.Store != nil {
+		records, err := m.Store.LoadUsage(sessionID)
+		if err != nil {
+			return 0, err
+		}
+		for _, record := range records {
+			cost, _ := m.Prices.Cost(record.Model, record.PromptTokens, record.CompletionTokens)
+			spent += cost
+		}
+	}
+	m.spent[sessionID] = spent
+	return spent, nil
+}
+
+// CheckBudget returns ErrBudgetExceeded once the session has spent its
+// budget. A budget of 0 never runs out.
+func (m *UsageMeter) CheckBudget(sessionID string, budget float64) error {
+	if budget <= 0 {
+		return nil
+	}
+	spent, err := m.Spent(sessionID)
+	if err != nil {
+		return err
+	}
+	if spent >= budget {
+		return ErrBudgetExceeded
+	}
+	return nil
+}
+
+// Record stores the usage of one call. Failures to store it are logged
+// rather than failing a call that already succeeded.
+func (m *UsageMeter) Record(sessionID string, operation string, model string, usage Usage) {
+	record := models.UsageRecord{
+		SessionID:        sessionID,
+		Operation:        operation,
+		Model:            model,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		CreatedAt:        time.Now(),
+	}
+	cost, priced := m.Prices.Cost(model, usage.PromptTokens, usage.CompletionTokens)
+	if !priced {
+		log.Printf("No price for model %q; its usage is recorded without cost", model)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, err := m.spentLocked(sessionID); err != nil {
+		log.Printf("Error loading usage of session %s: %v", sessionID, err)
+	}
+	m.spent[sessionID] += cost
+	if m.Store != nil {
+		if err := m.Store.RecordUsage(record); err != nil {
+			log.Printf("Error recording usage of session %s: %v", sessionID, err)
+		}
+	}
+}
+
+// Reports totals the stored usage by session, operation and model. With a
+// session ID only that session is reported.
+func (m *UsageMeter) Reports(sessionID string) ([]UsageReport, error) {
+	records := []models.UsageRecord{}
+	if m.Store != nil {
+		var err error
+		if records, err = m.Store.LoadUsage(sessionID); err != nil {
+			return nil, err
+		}
+	}
+
+	bySession := map[string]*UsageReport{}
+	byOperation := map[[3]string]*OperationUsage{}
+	for _, record := range records {
+		report, ok := bySession[record.SessionID]
+		if !ok {
+			report = &UsageReport{SessionID: record.SessionID}
+			bySession[record.SessionID] = report
+		}
+		key := [3]string{record.SessionID, record.Operation, record.Model}
+		operation, ok := byOperation[key]
+		if !ok {
+			operation = &OperationUsage{Operation: record.Operation, Model: record.Model, Priced: true}
+			byOperation[key] = operation
+		}
+		cost, priced := m.Prices.Cost(record.Model, record.PromptTokens, record.CompletionTokens)
+		operation.Calls++
+		operation.PromptTokens += record.PromptTokens
+		operation.CompletionTokens += record.CompletionTokens
+		operation.Cost += cost
+		operation.Priced = operation.Priced && priced
+		report.PromptTokens += record.PromptTokens
+		report.CompletionTokens += record.CompletionTokens
+		report.Cost += cost
+	}
+	for key, operation := range byOperation {
+		report := bySession[key[0]]
+		report.Operations = append(report.Operations, *operation)
+	}
+
+	reports := make([]UsageReport, 0, len(bySession))
+	for _, report := range bySession {
+		sort.Slice(report.Operations, func(i, j int) bool {
+			a, b := report.Operations[i], report.Operations[j]
+			return a.Operation < b.Operation || (a.Operation == b.Operation && a.Model < b.Model)
+		})
+		reports = append(reports, *report)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].SessionID < reports[j].SessionID })
+	if sessionID != "" && len(reports) == 0 {
+		reports = append(reports, UsageReport{SessionID: sessionID, Operations: []OperationUsage{}})
+	}
+	return reports, nil
+}
+
+// MeteredProvider wraps an LLMProvider to record the usage of every call
+// made within a UsageScope and to refuse calls once the scope's budget is
+// spent. Calls without a scope pass through unmetered.
+type MeteredProvider struct {
+	LLMProvider
+	Meter *UsageMeter
+}
+
+func NewMeteredProvider(provider LLMProvider, meter *UsageMeter) *MeteredProvider {
+	return &MeteredProvider{LLMProvider: provider, Meter: meter}
+}
+
+func (p *MeteredProvider) Complete(ctx context.Context, request APIRequest) (Completion, error) {
+	return p.metered(ctx, func() (Completion, error) {
+		return p.LLMProvider.Complete(ctx, request)
+	})
+}
+
+func (p *MeteredProvider) Stream(ctx context.Context, request APIRequest, onDelta func(delta string)) (Completion, error) {
+	return p.metered(ctx, func() (Completion, error) {
+		return p.LLMProvider.Stream(ctx, request, onDelta)
+	})
+}
+
+func (p *MeteredProvider) metered(ctx context.Context, call func() (Completion, error)) (Completion, error) {
+	scope, ok := ctx.Value(usageScopeKey{}).(UsageScope)
+	if !ok {
+		return call()
+	}
+	if err := p.Meter.CheckBudget(scope.SessionID, scope.Budget); err != nil {
+		return Completion{}, err
+	}
+	completion, err := call()
+	if err != nil {
+		return completion, err
+	}
+	operation, _ := ctx.Value(operationKey{}).(string)
+	p.Meter.Record(scope.SessionID, operation, completion.Model, completion.Usage)
+	return completion, nil
+}
+
+// MeteredEmbedder is MeteredProvider for an Embedder. Embedders that report
+// no tokens, like the offline one, are not recorded.
+type MeteredEmbedder struct {
+	Embedder
+	Meter *UsageMeter
+}
+
+func NewMeteredEmbedder(embedder Embedder, meter *UsageMeter) *MeteredEmbedder {
+	return &MeteredEmbedder{Embedder: embedder, Meter: meter}
+}
+
+func (e *MeteredEmbedder) Embed(ctx context.Context, texts []string) (Embeddings, error) {
+	scope, ok := ctx.Value(usageScopeKey{}).(UsageScope)
+	if !ok {
+		return e.Embedder.Embed(ctx, texts)
+	}
+	if err := e.Meter.CheckBudget(scope.SessionID, scope.Budget); err != nil {
+		return Embeddings{}, err
+	}
+	embeddings, err := e.Embedder.Embed(ctx, texts)
+	if err != nil {
+		return embeddings, err
+	}
+	if embeddings.Usage != (Usage{}) {
+		e.Meter.Record(scope.SessionID, OperationEmbedding, embeddings.Model, embeddings.Usage)
+	}
+	return embeddings, nil
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DescribeVideo turns an uploaded video into text: a vision model describes
+// its keyframes and the audio track is transcribed. Without ffmpeg the file
+// is handed to the transcriber as is, so only the spoken part is captured.
+func (mp *MediaProcessor) DescribeVideo(ctx context.Context, mediaURL string) (string, error) {
+	path, ok, err := mp.localMediaPath(mediaURL)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("video %q is not an uploaded file", mediaURL)
+	}
+
+	if mp.Video == nil || !mp.Video.Available() {
+		log.Printf("ffmpeg not found; describing %s from its audio only", mediaURL)
+		transcript, err := mp.TranscribeAudio(ctx, mediaURL)
+		if err != nil {
+			return "", err
+		}
+		return "Audio transcript: " + transcript + "\n(Keyframes were not analyzed because ffmpeg is not installed.)", nil
+	}
+
+	dir, err := os.MkdirTemp("", "video-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	var parts []string
+
+	frames, err := mp.Video.ExtractKeyframes(ctx, path, dir)
+	if err != nil {
+		return "", err
+	}
+	if len(frames) > 0 {
+		visual, err := mp.describeKeyframes(ctx, frames)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, "Visual description: "+visual)
+	}
+
+	audioPath, err := mp.Video.ExtractAudio(ctx, path, dir)
+	if err != nil {
+		return "", err
+	}
+	if audioPath != "" {
+		if mp.Transcriber == nil {
+			return "", errors.New("no transcriber configured")
+		}
+		transcript, err := mp.Transcriber.Transcribe(ctx, audioPath)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, "Audio transcript: "+transcript)
+	}
+
+	if len(parts) == 0 {
+		return "", fmt.Errorf("video %q has no frames or audio", mediaURL)
+	}
+	return strings.Join(parts, "\n"), nil
+}
+
+// describeKeyframes sends all frames in one vision request so the model can
+// describe the video as a whole.
+func (mp *MediaProcessor) describeKeyframes(ctx context.Context, frames []string) (string, error) {
+	messages := []Message{}
+	for i, frame := range frames {
+		dataURL, err := mp.Images.DataURL(frame)
+		if err != nil {
+			return "", err
+		}
+		messages = append(messages, CreateMessage("user", Content{
+			ContentType: "image",
+			Text:        "Keyframe " + strconv.Itoa(i+1) + " of " + strconv.Itoa(len(frames)) + " from a video.",
+			ImageURL:    dataURL,
+		}))
+	}
+	messages = append(messages, CreateMessage("user", Content{
+		ContentType: "text",
+		Text:        "Describe what this video shows based on the keyframes above and extract any relevant information from it.",
+	}))
+
+	completion, err := mp.Provider.Complete(ctx, APIRequest{Model: mp.MediaModel, Messages: messages})
+	if err != nil {
+		return "", err
+	}
+	return completion.Content, nil
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultVideoKeyframes is how many keyframes are sampled from a video.
+const DefaultVideoKeyframes = 4
+
+// VideoProcessor splits videos into keyframes and an audio track with
+// ffmpeg. When ffmpeg is not installed FFmpegPath is empty and Available
+// reports false.
+type VideoProcessor struct {
+	FFmpegPath string
+	Keyframes  int
+}
+
+// NewVideoProcessor looks for ffmpeg on the PATH.
+func NewVideoProcessor() *VideoProcessor {
+	path, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		path = ""
+	}
+	return &VideoProcessor{FFmpegPath: path, Keyframes: DefaultVideoKeyframes}
+}
+
+func (v *VideoProcessor) Available() bool {
+	return v.FFmpegPath != ""
+}
+
+// ExtractKeyframes writes up to Keyframes frames of the video into dir as
+// JPEG files and returns their paths in order. The frames are spread evenly
+// over the video, each one a keyframe near its point in time, so
+// long videos are not described by their opening seconds alone. When the
+// duration cannot be read, the first keyframes are taken instead.
+func (v *VideoProcessor) ExtractKeyframes(ctx context.Context, videoPath string, dir string) ([]string, error) {
+	if duration, ok := parseDuration(v.probe(ctx, videoPath)); ok {
+		for i, at := range sampleTimes(duration, v.Keyframes) {
+			frame := filepath.Join(dir, fmt.Sprintf("frame-%03d.jpg", i+1))
+			err := v.run(ctx, "-ss", strconv.FormatFloat(at.Seconds(), 'f', 3, 64), "-skip_frame", "nokey",
+				"-i", videoPath, "-frames:v", "1", "-q:v", "3", frame)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		pattern := filepath.Join(dir, "frame-%03d.jpg")
+		err := v.run(ctx, "-skip_frame", "nokey", "-i", videoPath,
+			"-vsync", "vfr", "-frames:v", strconv.Itoa(v.Keyframes), "-q:v", "3", pattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+	frames, err := filepath.Glob(filepath.Join(dir, "frame-*.jpg"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(frames)
+	return frames, nil
+}
+
+// sampleTimes returns n points in time spread evenly over duration, the
+// first at its start.
+func sampleTimes(duration time.Duration, n int) []time.Duration {
+	times := make([]time.Duration, n)
+	for i := range times {
+		times[i] = duration * time.Duration(i) / time.Duration(n)
+	}
+	return times
+}
+
+// durationPattern matches the length ffmpeg prints for an input, such as
+// "Duration: 00:01:23.45".
+var durationPattern = regexp.MustCompile(`Duration: (\d+):(\d{2}):(\d{2}(?:\.\d+)?)`)
+
+// parseDuration reads a video's length from ffmpeg's log, reporting false
+// when it is missing or zero, as for live streams.
+func parseDuration(log string) (time.Duration, bool) {
+	match := durationPattern.FindStringSubmatch(log)
+	if match == nil {
+		return 0, false
+	}
+	hours, _ := strconv.Atoi(match[1])
+	minutes, _ := strconv.Atoi(match[2])
+	seconds, _ := strconv.ParseFloat(match[3], 64)
+	duration := time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute +
+		time.Duration(seconds*float64(time.Second))
+	return duration, duration > 0
+}
+
+// ExtractAudio writes the video's audio track into dir as a mono MP3, which
+// keeps the upload to the transcriber small. It returns "" when the video
+// has no audio.
+func (v *VideoProcessor) ExtractAudio(ctx context.Context, videoPath string, dir string) (string, error) {
+	if !v.hasAudio(ctx, videoPath) {
+		return "", nil
+	}
+	audioPath := filepath.Join(dir, "audio.mp3")
+	err := v.run(ctx, "-i", videoPath, "-map", "0:a:0", "-vn", "-ac", "1", "-ar", "16000", "-b:a", "48k", audioPath)
+	if err != nil {
+		return "", err
+	}
+	return audioPath, nil
+}
+
+// hasAudio reports whether the video has an audio track.
+func (v *VideoProcessor) hasAudio(ctx context.Context, videoPath string) bool {
+	return strings.Contains(v.probe(ctx, videoPath), "Audio:")
+}
+
+// probe returns the stream list and duration ffmpeg prints for an input.
+// Without an output ffmpeg always exits with an error, so only its log is
+// returned.
+func (v *VideoProcessor) probe(ctx context.Context, videoPath string) string {
+	cmd := exec.CommandContext(ctx, v.FFmpegPath, "-hide_banner", "-i", videoPath)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	cmd.Run()
+	return stderr.String()
+}
+
+func (v *VideoProcessor) run(ctx context.Context, args ...string) error {
+	args = append([]string{"-hide_banner", "-loglevel", "error", "-y"}, args...)
+	cmd := exec.CommandContext(ctx, v.FFmpegPath, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	log := `Input #0, mov,mp4,m4a,3gp,3g2,mj2, from 'idea.mp4':
+  Duration: 01:02:03.50, start: 0.000000, bitrate: 1205 kb/s
+  Stream #0:0(und): Video: h264 (High), yuv420p, 1280x720, 25 fps
+At least one output file must be specified`
+	duration, ok := parseDuration(log)
+	want := time.Hour + 2*time.Minute + 3500*time.Millisecond
+	if !ok || duration != want {
+		t.Fatalf("parseDuration = %v, %v, want %v", duration, ok, want)
+	}
+
+	for _, log := range []string{"", "Duration: N/A, start: 0.000000", "Duration: 00:00:00.00"} {
+		if _, ok := parseDuration(log); ok {
+			t.Errorf("parseDuration(%q) reported a duration", log)
+		}
+	}
+}
+
+func TestSampleTimesSpreadOverVideo(t *testing.T) {
+	got := sampleTimes(2*time.Minute, 4)
+	want := []time.Duration{0, 30 * time.Second, time.Minute, 90 * time.Second}
+	if len(got) != len(want) {
+		t.Fatalf("sampleTimes = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("sampleTimes = %v, want %v", got, want)
+		}
+	}
+}
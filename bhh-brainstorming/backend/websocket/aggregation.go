@@ -0,0 +1,446 @@
+// File: backend/websocket/aggregation.go
+package websocket
+
+import (
+	"bhh-brainstorming/backend/models"
+	"bhh-brainstorming/backend/services"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+// aggregationTimeout bounds a whole aggregation job, including the time it
+// waits in the queue and processing ideas that have no text yet.
+const aggregationTimeout = 15 * time.Minute
+
+// maxRunningAggregations limits how many sessions aggregate at once. Later
+// jobs stay queued until a slot frees up.
+const maxRunningAggregations = 2
+
+// JobState is where an aggregation job is in its life cycle.
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobDone      JobState = "done"
+	JobFailed    JobState = "failed"
+	JobCancelled JobState = "cancelled"
+)
+
+// Active reports whether the job has not finished yet.
+func (s JobState) Active() bool {
+	return s == JobQueued || s == JobRunning
+}
+
+// AggregationJob is the status of one aggregation run, sent to clients in
+// aggregation_job messages whenever its state changes.
+type AggregationJob struct {
+	ID          string                     `json:"id"`
+	State       JobState                   `json:"state"`
+	RequestedBy string                     `json:"requestedBy"`
+	CancelledBy string                     `json:"cancelledBy,omitempty"`
+	Stage       *services.AggregationStage `json:"stage,omitempty"`
+	Error       string                     `json:"error,omitempty"`
+	CreatedAt   time.Time                  `json:"createdAt"`
+	UpdatedAt   time.Time                  `json:"updatedAt"`
+}
+
+// aggregationJob is the hub's record of a session's latest job. seq counts
+// the aggregation_chunk messages sent for it and text holds what they
+// carried, for clients joining while it runs.
+type aggregationJob struct {
+	AggregationJob
+	sessionID string
+	cancel    context.CancelFunc
+	seq       int
+	text      strings.Builder
+}
+
+// AggregationChunk is the payload of an aggregation_chunk message.
+type AggregationChunk struct {
+	Seq   int    `json:"seq"`
+	Delta string `json:"delta"`
+}
+
+// AggregationProgress is sent to clients joining during an aggregation.
+// Chunks with a Seq at or below this one are already included in Text.
+type AggregationProgress struct {
+	Seq  int    `json:"seq"`
+	Text string `json:"text"`
+}
+
+func (h *Hub) handleAggregateIdeas(client *Client, message Message) {
+	session, ok := h.sessionFor(client, message)
+	if !ok {
+		return
+	}
+	sessionID := session.ID
+	if !session.GetPhase().AllowsAggregation() {
+		sendError(client, message, CodeWrongPhase, "The session is closed")
+		return
+	}
+	if h.mediaProcessor == nil {
+		sendError(client, message, CodeUnavailable, "Media processor not configured")
+		return
+	}
+
+	if !h.checkBudget(client, message, session) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(h.usageContext(session), aggregationTimeout)
+	job, started := h.startJob(sessionID, client.userID, cancel)
+	if !started {
+		cancel()
+		sendError(client, message, CodeConflict, "An aggregation is already running for this session")
+		h.sendJob(client, sessionID)
+		return
+	}
+
+	if err := h.commit(models.EventAggregationRequested, sessionID, client.userID, models.AggregationRequestedData{JobID: job.ID}); err != nil {
+		log.Printf("Error recording aggregation request: %v", err)
+		h.finishJob(job, JobFailed, err.Error())
+		sendError(client, message, CodeInternal, "Failed to start the aggregation")
+		return
+	}
+	client.ack().JobID = job.ID
+
+	// Media processing fills in transcripts meanwhile, so work on a copy
+	var items []services.MediaItem
+
+	for _, idea := range session.GetIdeas() {
+		items = append(items, services.MediaItem{
+			ID:          idea.ID,
+			MediaType:   idea.MediaType,
+			MediaURL:    idea.MediaURL,
+			Content:     idea.Content,
+			Transcript:  idea.Transcript,
+			Description: idea.Description,
+
+			GuidingQuestion: idea.GuidingQuestion,
+		})
+	}
+
+	go h.runAggregation(ctx, job, items, h.aggregationConfig(session))
+}
+
+// aggregationConfig applies the session's choice of model and prompt
+// template. A template that is no longer installed falls back to the
+// default rather than blocking the session.
+func (h *Hub) aggregationConfig(session *models.Session) services.AggregationConfig {
+	config := services.AggregationConfig{
+		Model:   session.Model,
+		Session: services.SessionPromptData(session),
+	}
+	if template, ok := h.mediaProcessor.Prompts.Get(session.PromptTemplate); ok {
+		config.Template = template
+	} else {
+		log.Printf("Prompt template %q of session %s is not installed; using the default", session.PromptTemplate, session.ID)
+	}
+	return config
+}
+
+// runAggregation waits for a free slot, runs the job and reports how it
+// ended. A job cancelled while queued never starts.
+func (h *Hub) runAggregation(ctx context.Context, job *aggregationJob, items []services.MediaItem, config services.AggregationConfig) {
+	defer job.cancel()
+	sessionID := job.sessionID
+
+	select {
+	case h.aggregationSlots <- struct{}{}:
+		defer func() { <-h.aggregationSlots }()
+	case <-ctx.Done():
+		h.endJob(job, ctx.Err())
+		return
+	}
+	h.updateJob(job, func(status *AggregationJob) {
+		status.State = JobRunning
+	})
+
+	// First inform all clients that aggregation has started
+	startMsg, _ := json.Marshal(Message{
+		Type:      "aggregation_started",
+		SessionID: sessionID,
+		Data:      "Processing ideas ...",
+	})
+	h.broadcastToSession(sessionID, startMsg)
+
+	result, err := h.mediaProcessor.AggregateMedia(ctx, items, config, services.AggregationHooks{
+		OnDelta: func(delta string) {
+			h.sendChunk(job, delta)
+		},
+		OnStage: func(stage services.AggregationStage) {
+			h.sendStage(job, stage)
+		},
+	})
+	if err != nil {
+		h.endJob(job, err)
+		return
+	}
+
+	result.ID = job.ID
+	completed := models.AggregationCompletedData{JobID: job.ID, Content: result.Summary, Aggregation: result}
+	describe := func(*models.Session) (Message, bool) {
+		return Message{Type: "aggregation_result", Data: result}, true
+	}
+	if err := h.publish(models.EventAggregationCompleted, sessionID, "", completed, describe); err != nil {
+		log.Printf("Error recording aggregation result: %v", err)
+		// Still show the result; it just cannot be replayed
+		aggregation, _ := json.Marshal(Message{
+			Type:      "aggregation_result",
+			SessionID: sessionID,
+			Data:      result,
+		})
+		h.broadcastToSession(sessionID, aggregation)
+	}
+	h.finishJob(job, JobDone, "")
+}
+
+// endJob records a job that stopped with err, either because it was
+// cancelled or because aggregation failed.
+func (h *Hub) endJob(job *aggregationJob, err error) {
+	sessionID := job.sessionID
+	if errors.Is(err, context.Canceled) {
+		h.jobsMutex.Lock()
+		cancelledBy := job.CancelledBy
+		h.jobsMutex.Unlock()
+		if err := h.commit(models.EventAggregationCancelled, sessionID, cancelledBy, models.AggregationCancelledData{JobID: job.ID}); err != nil {
+			log.Printf("Error recording aggregation cancellation: %v", err)
+		}
+		h.finishJob(job, JobCancelled, "")
+		return
+	}
+
+	log.Printf("Error during idea aggregation: %v", err)
+	failure := Message{Type: "aggregation_error", Data: "Failed to aggregate ideas: " + err.Error()}
+	describe := func(*models.Session) (Message, bool) { return failure, true }
+	if err := h.publish(models.EventAggregationFailed, sessionID, "", models.AggregationFailedData{JobID: job.ID, Error: err.Error()}, describe); err != nil {
+		log.Printf("Error recording aggregation failure: %v", err)
+		failure.SessionID = sessionID
+		errorMsg, _ := json.Marshal(failure)
+		h.broadcastToSession(sessionID, errorMsg)
+	}
+	h.finishJob(job, JobFailed, err.Error())
+}
+
+// handleCancelAggregation cancels the session's running aggregation. The
+// request may name the job, so a late click cannot cancel a newer one.
+func (h *Hub) handleCancelAggregation(client *Client, message Message, data CancelAggregationData) {
+	session, ok := h.sessionFor(client, message)
+	if !ok {
+		return
+	}
+
+	h.jobsMutex.Lock()
+	defer h.jobsMutex.Unlock()
+	job, ok := h.jobs[session.ID]
+	if !ok || !job.State.Active() || (data.JobID != "" && data.JobID != job.ID) {
+		sendError(client, message, CodeNotFound, "No aggregation is running")
+		return
+	}
+	if job.CancelledBy == "" {
+		job.CancelledBy = client.userID
+	}
+	job.cancel()
+}
+
+func (h *Hub) handleAggregationStatus(client *Client, message Message) {
+	session, ok := h.sessionFor(client, message)
+	if !ok {
+		return
+	}
+	h.sendJob(client, session.ID)
+}
+
+func (h *Hub) handleAggregationHistory(client *Client, message Message) {
+	session, ok := h.sessionFor(client, message)
+	if !ok {
+		return
+	}
+
+	response, _ := json.Marshal(Message{
+		Type:      "aggregation_history",
+		SessionID: session.ID,
+		Data:      session.GetAggregationHistory(),
+	})
+	client.send <- response
+}
+
+func (h *Hub) handleAggregationDiff(client *Client, message Message, data AggregationDiffData) {
+	session, ok := h.sessionFor(client, message)
+	if !ok {
+		return
+	}
+
+	fromID, toID := data.From, data.To
+	history := session.GetAggregationHistory()
+	if fromID == "" && toID == "" {
+		if len(history) < 2 {
+			sendError(client, message, CodeNotFound, "The session needs two aggregations to compare")
+			return
+		}
+		fromID, toID = history[len(history)-2].ID, history[len(history)-1].ID
+	}
+	from, fromFound := session.FindAggregation(fromID)
+	to, toFound := session.FindAggregation(toID)
+	if !fromFound || !toFound {
+		sendError(client, message, CodeNotFound, "Aggregation not found")
+		return
+	}
+
+	response, _ := json.Marshal(Message{
+		Type:      "aggregation_diff",
+		SessionID: session.ID,
+		Data:      models.DiffAggregations(from, to),
+	})
+	client.send <- response
+}
+
+// startJob registers a new queued job for the session unless one is still
+// active, in which case the active job is returned with started false.
+func (h *Hub) startJob(sessionID string, userID string, cancel context.CancelFunc) (job *aggregationJob, started bool) {
+	h.jobsMutex.Lock()
+	defer h.jobsMutex.Unlock()
+	if current, ok := h.jobs[sessionID]; ok && current.State.Active() {
+		return current, false
+	}
+
+	now := time.Now()
+	job = &aggregationJob{
+		AggregationJob: AggregationJob{
+			ID:          generateSessionID(),
+			State:       JobQueued,
+			RequestedBy: userID,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		},
+		sessionID: sessionID,
+		cancel:    cancel,
+	}
+	h.jobs[sessionID] = job
+	h.broadcastJob(job)
+	return job, true
+}
+
+// updateJob changes the job's status and broadcasts it. Jobs that were
+// replaced or dropped with their session are left alone.
+func (h *Hub) updateJob(job *aggregationJob, update func(status *AggregationJob)) {
+	h.jobsMutex.Lock()
+	defer h.jobsMutex.Unlock()
+	if h.jobs[job.sessionID] != job {
+		return
+	}
+	update(&job.AggregationJob)
+	job.UpdatedAt = time.Now()
+	h.broadcastJob(job)
+}
+
+func (h *Hub) finishJob(job *aggregationJob, state JobState, errText string) {
+	h.updateJob(job, func(status *AggregationJob) {
+		status.State = state
+		status.Error = errText
+	})
+}
+
+// dropJob cancels the session's job, if any, and forgets it. It is called
+// when the session is removed.
+func (h *Hub) dropJob(sessionID string) {
+	h.jobsMutex.Lock()
+	defer h.jobsMutex.Unlock()
+	if job, ok := h.jobs[sessionID]; ok {
+		job.cancel()
+		delete(h.jobs, sessionID)
+	}
+}
+
+// broadcastJob sends the job's status to the session. Callers hold
+// jobsMutex, which keeps status messages in order.
+func (h *Hub) broadcastJob(job *aggregationJob) {
+	status, _ := json.Marshal(Message{
+		Type:      "aggregation_job",
+		SessionID: job.sessionID,
+		Data:      job.AggregationJob,
+	})
+	h.broadcastToSession(job.sessionID, status)
+}
+
+// sendJob replies with the status of the session's latest job, or with no
+// data when the session has not aggregated since the server started.
+func (h *Hub) sendJob(client *Client, sessionID string) {
+	h.jobsMutex.Lock()
+	defer h.jobsMutex.Unlock()
+	message := Message{Type: "aggregation_job", SessionID: sessionID}
+	if job, ok := h.jobs[sessionID]; ok {
+		message.Data = job.AggregationJob
+	}
+	status, _ := json.Marshal(message)
+	client.send <- status
+}
+
+// sendStage records the job's progress and broadcasts it.
+func (h *Hub) sendStage(job *aggregationJob, stage services.AggregationStage) {
+	h.jobsMutex.Lock()
+	defer h.jobsMutex.Unlock()
+	if h.jobs[job.sessionID] != job || job.State != JobRunning {
+		return
+	}
+	job.Stage = &stage
+	job.UpdatedAt = time.Now()
+
+	stageMsg, _ := json.Marshal(Message{
+		Type:      "aggregation_stage",
+		SessionID: job.sessionID,
+		Data:      stage,
+	})
+	h.broadcastToSession(job.sessionID, stageMsg)
+}
+
+// sendChunk records delta and broadcasts it. The job lock is held while
+// broadcasting so chunks reach every client in sequence order.
+func (h *Hub) sendChunk(job *aggregationJob, delta string) {
+	h.jobsMutex.Lock()
+	defer h.jobsMutex.Unlock()
+	if h.jobs[job.sessionID] != job || job.State != JobRunning {
+		return
+	}
+	job.seq++
+	job.text.WriteString(delta)
+
+	chunk, _ := json.Marshal(Message{
+		Type:      "aggregation_chunk",
+		SessionID: job.sessionID,
+		Data:      AggregationChunk{Seq: job.seq, Delta: delta},
+	})
+	h.broadcastToSession(job.sessionID, chunk)
+}
+
+// sendProgress catches a client up on an aggregation that has not finished:
+// its job status and, once running, the text streamed so far.
+func (h *Hub) sendProgress(client *Client, sessionID string) {
+	h.jobsMutex.Lock()
+	defer h.jobsMutex.Unlock()
+	job, ok := h.jobs[sessionID]
+	if !ok || !job.State.Active() {
+		return
+	}
+
+	status, _ := json.Marshal(Message{
+		Type:      "aggregation_job",
+		SessionID: sessionID,
+		Data:      job.AggregationJob,
+	})
+	client.send <- status
+	if job.State != JobRunning {
+		return
+	}
+	progress, _ := json.Marshal(Message{
+		Type:      "aggregation_progress",
+		SessionID: sessionID,
+		Data:      AggregationProgress{Seq: job.seq, Text: job.text.String()},
+	})
+	client.send <- progress
+}
@@ -3,11 +3,9 @@ package websocket
 
 import (
 	"log"
-	"math/rand"
 	"net/http"
-	"strconv"
-	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
@@ -20,11 +18,6 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-func getRandomUsername() string {
-	rand.Seed(time.Now().UnixNano())
-	return "User" + strconv.Itoa(rand.Intn(10000))
-}
-
 // ServeWs upgrades the HTTP connection and registers the client with the Hub.
 func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
@@ -33,19 +26,20 @@ func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID := r.URL.Query().Get("user")
-	if userID == "" {
-		userID = getRandomUsername()
-	}
+	// Roles are tied to user IDs, so the server picks them; a returning
+	// client takes its old ID back with its resume token
+	userID := uuid.NewString()
 
 	client := &Client{
 		hub:    hub,
 		conn:   conn,
 		send:   make(chan []byte, 256),
 		userID: userID,
+		token:  hub.identities.issue(userID),
 	}
 
 	hub.register <- client
+	hub.sendConnected(client)
 
 	go client.writePump()
 	go client.readPump()
@@ -0,0 +1,100 @@
+// File: backend/websocket/cluster.go
+package websocket
+
+import (
+	"bhh-brainstorming/backend/models"
+	"bhh-brainstorming/backend/services"
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// embeddingTimeout bounds embedding one idea, or all of a session's ideas
+// for clustering.
+const embeddingTimeout = 2 * time.Minute
+
+// DuplicateWarning is the payload of a possible_duplicates message: the
+// existing ideas a newly submitted one closely resembles.
+type DuplicateWarning struct {
+	IdeaID     string               `json:"ideaId"`
+	Duplicates []services.Duplicate `json:"duplicates"`
+}
+
+// checkDuplicates compares a newly submitted idea with the rest of the
+// session and warns its submitter when it looks like one already there.
+// Nobody else is told, so the submitter can decide what to do about it.
+func (h *Hub) checkDuplicates(client *Client, sessionID string, idea models.Idea) {
+	session, err := h.sessions.GetSession(sessionID)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(h.usageContext(session), embeddingTimeout)
+	defer cancel()
+
+	duplicates, err := h.ideaIndex.Duplicates(ctx, idea, session.GetIdeas())
+	if err != nil {
+		log.Printf("Error looking for duplicates of idea %s: %v", idea.ID, err)
+		return
+	}
+	if len(duplicates) == 0 {
+		return
+	}
+	warning, _ := json.Marshal(Message{
+		Type:      "possible_duplicates",
+		SessionID: sessionID,
+		Data:      DuplicateWarning{IdeaID: idea.ID, Duplicates: duplicates},
+	})
+	h.sendToClient(client, sessionID, warning)
+}
+
+func (h *Hub) handleClusterIdeas(client *Client, message Message) {
+	session, ok := h.sessionFor(client, message)
+	if !ok {
+		return
+	}
+	if h.ideaIndex == nil {
+		sendError(client, message, CodeUnavailable, "Idea clustering is not configured")
+		return
+	}
+	if len(session.GetIdeas()) == 0 {
+		sendError(client, message, CodeNotFound, "There are no ideas to cluster")
+		return
+	}
+	if !h.checkBudget(client, message, session) {
+		return
+	}
+
+	go h.clusterIdeas(client, message, session)
+}
+
+// clusterIdeas groups the session's ideas, stores the clusters on the
+// session and sends them to everyone in it.
+func (h *Hub) clusterIdeas(client *Client, message Message, session *models.Session) {
+	ctx, cancel := context.WithTimeout(h.usageContext(session), embeddingTimeout)
+	defer cancel()
+
+	clustering, err := h.ideaIndex.Cluster(ctx, session.GetIdeas())
+	if err != nil {
+		log.Printf("Error clustering ideas of session %s: %v", session.ID, err)
+		h.sendToClient(client, session.ID, errorReply(message, CodeInternal, "Clustering the ideas failed"))
+		return
+	}
+	if err := h.publish(models.EventIdeasClustered, session.ID, client.userID, models.IdeasClusteredData{Clustering: clustering},
+		func(*models.Session) (Message, bool) {
+			return Message{Type: "ideas_clustered", Data: clustering}, true
+		}); err != nil {
+		log.Printf("Error recording clusters of session %s: %v", session.ID, err)
+		h.sendToClient(client, session.ID, errorReply(message, CodeInternal, "Failed to save the clusters"))
+	}
+}
+
+// sendToClient delivers a message produced by background work, as long as
+// the client is still in the session it was produced for.
+func (h *Hub) sendToClient(client *Client, sessionID string, message []byte) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if h.clientSessions[client] == sessionID {
+		client.send <- message
+	}
+}
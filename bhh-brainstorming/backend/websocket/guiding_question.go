@@ -0,0 +1,47 @@
+// File: backend/websocket/guiding_question.go
+package websocket
+
+import (
+	"bhh-brainstorming/backend/models"
+	"log"
+)
+
+// validQuestion reports whether question numbers one of the session's
+// guiding questions, counting from 1. 0 means no question and is always
+// valid.
+func validQuestion(session *models.Session, question int) bool {
+	return question >= 0 && question <= len(session.GuidingQuestions)
+}
+
+// handleTagIdea sets or clears the guiding question an idea answers, for
+// instance to accept the question suggested by the latest aggregation.
+// Only the idea's author and facilitators may retag it.
+func (h *Hub) handleTagIdea(client *Client, message Message, data TagIdeaData) {
+	session, ok := h.sessionFor(client, message)
+	if !ok {
+		return
+	}
+	if !session.GetPhase().AllowsTagging() {
+		sendError(client, message, CodeWrongPhase, "The session is closed")
+		return
+	}
+	idea, exists := session.GetIdea(data.IdeaID)
+	if !exists {
+		sendError(client, message, CodeNotFound, "Idea not found")
+		return
+	}
+	if idea.SubmittedBy.ID != client.userID && !session.GetRole(client.userID).CanFacilitate() {
+		sendError(client, message, CodeForbidden, "Only the idea's author or a facilitator can tag it")
+		return
+	}
+	if !validQuestion(session, data.GuidingQuestion) {
+		sendError(client, message, CodeInvalidData, "No such guiding question")
+		return
+	}
+
+	tagged := models.IdeaTaggedData{IdeaID: data.IdeaID, GuidingQuestion: data.GuidingQuestion}
+	if err := h.publish(models.EventIdeaTagged, session.ID, client.userID, tagged, ideaUpdate(data.IdeaID)); err != nil {
+		log.Printf("Error tagging idea %s: %v", data.IdeaID, err)
+		sendError(client, message, CodeInternal, "Failed to tag the idea")
+	}
+}
@@ -20,6 +20,10 @@ type Client struct {
 	send     chan []byte
 	userID   string
 	Username string
+	// token is the resume token the client was issued or resumed with
+	token string
+	// request is the message being handled, set only while it is being handled
+	request *pendingRequest
 }
 
 func (c *Client) readPump() {
@@ -67,7 +71,25 @@ type Hub struct {
 	unregister     chan *Client
 	broadcast      chan []byte
 	mediaProcessor *services.MediaProcessor
+	usage          *services.UsageMeter
+	ideaIndex      *services.IdeaIndex
+	journal        *models.Journal
+	requests       *requestLog
+	identities     *identities
 	mutex          sync.RWMutex
+	// commitMutex orders commits, so the events of a session are numbered
+	// and published in the order they were applied
+	commitMutex sync.Mutex
+	// backlogs holds recent published messages of each session for clients
+	// that resume; guarded by commitMutex
+	backlogs map[string]*backlog
+	// departures holds the pending removal of each disconnected user
+	departures      map[departureKey]*time.Timer
+	departuresMutex sync.Mutex
+	// jobs holds the latest aggregation job of each session
+	jobs             map[string]*aggregationJob
+	jobsMutex        sync.Mutex
+	aggregationSlots chan struct{}
 }
 
 type Message struct {
@@ -75,22 +97,31 @@ type Message struct {
 	SessionID string      `json:"sessionId,omitempty"`
 	UserID    string      `json:"userId,omitempty"`
 	Username  string      `json:"username,omitempty"`
+	RequestID string      `json:"requestId,omitempty"` // set by the client, echoed in replies
+	Seq       int64       `json:"seq,omitempty"`       // of the session event the message reports
 	Data      interface{} `json:"data,omitempty"`
 }
 
-func NewHub() *Hub {
+func NewHub(sessions *models.SessionManager) *Hub {
 	return &Hub{
-		sessions:       models.NewSessionManager(),
-		clients:        make(map[*Client]bool),
-		clientSessions: make(map[*Client]string),
-		register:       make(chan *Client),
-		unregister:     make(chan *Client),
-		broadcast:      make(chan []byte),
-		mediaProcessor: nil,
+		sessions:         sessions,
+		clients:          make(map[*Client]bool),
+		clientSessions:   make(map[*Client]string),
+		register:         make(chan *Client),
+		unregister:       make(chan *Client),
+		broadcast:        make(chan []byte),
+		mediaProcessor:   nil,
+		requests:         newRequestLog(),
+		identities:       newIdentities(),
+		backlogs:         make(map[string]*backlog),
+		departures:       make(map[departureKey]*time.Timer),
+		jobs:             make(map[string]*aggregationJob),
+		aggregationSlots: make(chan struct{}, maxRunningAggregations),
 	}
 }
 
 func (h *Hub) Run() {
+	h.scheduleRestoredDepartures()
 	for {
 		select {
 		case client := <-h.register:
@@ -99,21 +130,22 @@ func (h *Hub) Run() {
 			h.mutex.Unlock()
 		case client := <-h.unregister:
 			h.mutex.Lock()
-			if _, ok := h.clients[client]; ok {
-				if sessionID, inSession := h.clientSessions[client]; inSession {
-					if session, err := h.sessions.GetSession(sessionID); err == nil {
-						session.RemoveUser(client.userID)
-						h.notifySessionUpdate(sessionID)
-						if len(session.GetUsers()) == 0 {
-							h.sessions.RemoveSession(sessionID)
-						}
-					}
-					delete(h.clientSessions, client)
-				}
+			_, registered := h.clients[client]
+			sessionID, inSession := h.clientSessions[client]
+			if registered {
+				delete(h.clientSessions, client)
 				delete(h.clients, client)
 				close(client.send)
 			}
 			h.mutex.Unlock()
+			if registered {
+				h.identities.disconnect(client.token)
+			}
+			// A dropped connection may be resumed, so the user only leaves
+			// the session once the grace period is over.
+			if registered && inSession {
+				h.scheduleDeparture(sessionID, client.userID)
+			}
 		case message := <-h.broadcast:
 			h.mutex.RLock()
 			for client := range h.clients {
@@ -130,69 +162,73 @@ func (h *Hub) Run() {
 }
 
 func (h *Hub) HandleMessage(client *Client, rawMessage []byte) {
-	var message Message
-	if err := json.Unmarshal(rawMessage, &message); err != nil {
-		log.Printf("Error unmarshaling message: %v", err)
+	var envelope inboundMessage
+	if err := decodeStrict(rawMessage, &envelope); err != nil {
+		// Echo whatever type and requestId can still be read
+		json.Unmarshal(rawMessage, &envelope)
+		sendError(client, envelope.message(), CodeInvalidMessage, "Invalid message: "+err.Error())
+		return
+	}
+	message := envelope.message()
+	route, known := routes[message.Type]
+	if !known {
+		sendError(client, message, CodeUnknownType, "Unknown message type")
+		return
+	}
+	if h.replayRequest(client, message) {
 		return
 	}
 
-	switch message.Type {
-	case "create_session":
-		h.handleCreateSession(client, message)
-	case "join_session":
-		h.handleJoinSession(client, message)
-	case "leave_session":
-		h.handleLeaveSession(client)
-	case "list_sessions":
-		h.handleListSessions(client)
-	case "session_message":
-		h.handleSessionMessage(client, message)
-	case "idea_submission":
-		h.handleIdeaSubmission(client, message)
-	case "aggregate_ideas":
-		h.handleAggregateIdeas(client, message)
-	case "idea_rating":
-		h.handleIdeaRating(client, message)
-	case "start_discussion":
-		h.handleStartDiscussion(client, message)
+	request := &pendingRequest{message: message}
+	client.request = request
+	defer func() { client.request = nil }()
+	if h.authorize(client, message) {
+		if err := route(h, client, message, envelope.Data); err != nil {
+			sendError(client, message, CodeInvalidData, "Invalid "+message.Type+" data: "+err.Error())
+		}
 	}
+	h.finishRequest(client, request)
 }
 
-func (h *Hub) handleCreateSession(client *Client, message Message) {
-	// Expect Data to be a JSON object with "name" (string) and "guidingQuestions" ([]string)
-	dataMap, ok := message.Data.(map[string]interface{})
-	if !ok {
-		log.Println("Invalid data format for session creation")
-		response, _ := json.Marshal(Message{
-			Type: "error",
-			Data: "Invalid session creation data",
-		})
-		client.send <- response
-		return
-	}
-	name, nameOk := dataMap["name"].(string)
-	gqInterface, gqOk := dataMap["guidingQuestions"].([]interface{})
-	if !nameOk || name == "" || !gqOk {
-		log.Println("Missing session name or guiding questions")
-		response, _ := json.Marshal(Message{
-			Type: "error",
-			Data: "Session name and guiding questions are required",
-		})
-		client.send <- response
+func (h *Hub) handleCreateSession(client *Client, message Message, data CreateSessionData) {
+	if data.Name == "" || data.GuidingQuestions == nil {
+		sendError(client, message, CodeInvalidData, "Session name and guiding questions are required")
 		return
 	}
-	guidingQuestions := []string{}
-	for _, q := range gqInterface {
-		if qs, ok := q.(string); ok {
-			guidingQuestions = append(guidingQuestions, qs)
+	// The prompt template and model are optional and default to the server's
+	if h.mediaProcessor != nil {
+		if _, ok := h.mediaProcessor.Prompts.Get(data.PromptTemplate); !ok {
+			sendError(client, message, CodeInvalidData, "Unknown prompt template")
+			return
+		}
+		if data.Model != "" && !h.mediaProcessor.AllowsModel(data.Model) {
+			sendError(client, message, CodeInvalidData, "Unknown model")
+			return
 		}
 	}
 	user := models.User{
 		ID:       client.userID,
 		Username: message.Username,
 	}
-	session := h.sessions.CreateSession(name, guidingQuestions, user)
+	sessionID := h.sessions.NewSessionID()
+	if err := h.commit(models.EventSessionCreated, sessionID, client.userID, models.SessionCreatedData{
+		Name:             data.Name,
+		GuidingQuestions: data.GuidingQuestions,
+		Creator:          user,
+		CreatedAt:        time.Now(),
+		PromptTemplate:   data.PromptTemplate,
+		Model:            data.Model,
+	}); err != nil {
+		log.Printf("Error creating session: %v", err)
+		sendError(client, message, CodeInternal, "Failed to create session")
+		return
+	}
+	session, err := h.sessions.GetSession(sessionID)
+	if err != nil {
+		return
+	}
 	log.Printf("Session created: %+v", session)
+	client.ack().SessionID = session.ID
 	h.mutex.Lock()
 	h.clientSessions[client] = session.ID
 	h.mutex.Unlock()
@@ -205,21 +241,46 @@ func (h *Hub) handleCreateSession(client *Client, message Message) {
 	h.broadcastSessionsList()
 }
 
-func (h *Hub) handleJoinSession(client *Client, message Message) {
+func (h *Hub) handleJoinSession(client *Client, message Message, data JoinSessionData) {
 	session, err := h.sessions.GetSession(message.SessionID)
 	if err != nil {
-		response, _ := json.Marshal(Message{
-			Type: "error",
-			Data: "Session not found",
-		})
-		client.send <- response
+		sendError(client, message, CodeNotFound, "Session not found")
+		return
+	}
+	if session.IsBanned(client.userID) {
+		sendError(client, message, CodeForbidden, "You were removed from this session")
+		return
+	}
+	if data.Role != "" && data.Role != models.RoleObserver {
+		sendError(client, message, CodeInvalidData, "You can only ask to join as an observer")
 		return
 	}
 	user := models.User{
 		ID:       client.userID,
 		Username: message.Username,
 	}
-	session.AddUser(user)
+	// Returning users keep their role; newcomers join as participants unless
+	// they asked to observe.
+	role := session.GetRole(client.userID)
+	if !session.HasRole(client.userID) {
+		role = models.RoleParticipant
+		if data.Role == models.RoleObserver {
+			role = models.RoleObserver
+		}
+	}
+	if err := h.publish(models.EventUserJoined, session.ID, client.userID, models.UserJoinedData{
+		User: user,
+		Role: role,
+	}, sessionUpdate); err != nil {
+		log.Printf("Error joining session: %v", err)
+		sendError(client, message, CodeInternal, "Failed to join session")
+		return
+	}
+	// Joining again before the grace period is over keeps the user in the session
+	h.cancelDeparture(session.ID, client.userID)
+	// The copy of the session and the live messages after it must not
+	// overlap, so hold commits back until the client is attached
+	h.commitMutex.Lock()
 	h.mutex.Lock()
 	h.clientSessions[client] = session.ID
 	h.mutex.Unlock()
@@ -229,23 +290,17 @@ func (h *Hub) handleJoinSession(client *Client, message Message) {
 		Data: session,
 	})
 	client.send <- response
-	h.notifySessionUpdate(session.ID)
+	h.commitMutex.Unlock()
+	h.sendProgress(client, session.ID)
 }
 
-func (h *Hub) notifySessionUpdate(sessionID string) {
-	session, err := h.sessions.GetSession(sessionID)
-	if err != nil {
-		return
-	}
-	update, _ := json.Marshal(Message{
-		Type:      "session_updated",
-		SessionID: sessionID,
-		Data:      session,
-	})
-	h.broadcastToSession(sessionID, update)
+// sessionUpdate describes an event by the whole session it changed, for
+// events clients follow through session_updated.
+func sessionUpdate(session *models.Session) (Message, bool) {
+	return Message{Type: "session_updated", Data: session}, true
 }
 
-func (h *Hub) handleLeaveSession(client *Client) {
+func (h *Hub) handleLeaveSession(client *Client, message Message) {
 	h.mutex.Lock()
 	sessionID, inSession := h.clientSessions[client]
 	if inSession {
@@ -254,18 +309,32 @@ func (h *Hub) handleLeaveSession(client *Client) {
 	h.mutex.Unlock()
 
 	if inSession {
-		if session, err := h.sessions.GetSession(sessionID); err == nil {
-			session.RemoveUser(client.userID)
-			h.notifySessionUpdate(sessionID)
-			if len(session.GetUsers()) == 0 {
-				h.sessions.RemoveSession(sessionID)
-				h.broadcastSessionsList()
-			}
+		h.cancelDeparture(sessionID, client.userID)
+		h.removeUserFromSession(sessionID, client.userID)
+	}
+}
+
+// removeUserFromSession drops a departed user and deletes the session once
+// nobody is left in it.
+func (h *Hub) removeUserFromSession(sessionID string, userID string) {
+	session, err := h.sessions.GetSession(sessionID)
+	if err != nil {
+		return
+	}
+	if err := h.publish(models.EventUserLeft, sessionID, userID, nil, sessionUpdate); err != nil {
+		log.Printf("Error removing user %s from session %s: %v", userID, sessionID, err)
+		return
+	}
+	if len(session.GetUsers()) == 0 {
+		h.dropJob(sessionID)
+		if err := h.commit(models.EventSessionRemoved, sessionID, "", nil); err != nil {
+			log.Printf("Error removing session %s: %v", sessionID, err)
 		}
+		h.broadcastSessionsList()
 	}
 }
 
-func (h *Hub) handleListSessions(client *Client) {
+func (h *Hub) handleListSessions(client *Client, message Message) {
 	sessions := h.sessions.ListSessions()
 	response, _ := json.Marshal(Message{
 		Type: "sessions_list",
@@ -274,182 +343,236 @@ func (h *Hub) handleListSessions(client *Client) {
 	client.send <- response
 }
 
-func (h *Hub) handleSessionMessage(client *Client, message Message) {
-	h.mutex.RLock()
-	sessionID, inSession := h.clientSessions[client]
-	h.mutex.RUnlock()
-
-	if !inSession || sessionID != message.SessionID {
+// handleSessionMessage relays a chat message, whose data is its text.
+func (h *Hub) handleSessionMessage(client *Client, message Message, text string) {
+	session, ok := h.sessionFor(client, message)
+	if !ok {
 		return
 	}
-
-	messageJSON, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("Error marshaling message: %v", err)
+	sessionID := session.ID
+	if !session.GetPhase().AllowsChat() {
+		sendError(client, message, CodeWrongPhase, "The session is closed")
 		return
 	}
-	h.broadcastToSession(sessionID, messageJSON)
-}
 
-func (h *Hub) handleIdeaSubmission(client *Client, message Message) {
-	h.mutex.RLock()
-	sessionID, inSession := h.clientSessions[client]
-	h.mutex.RUnlock()
-	if !inSession || sessionID != message.SessionID {
-		return
+	// The message is relayed as it was sent
+	if err := h.publish(models.EventSessionMessage, sessionID, client.userID, models.SessionMessageData{
+		Username: message.Username,
+		Message:  text,
+	}, func(*models.Session) (Message, bool) { return message, true }); err != nil {
+		log.Printf("Error recording session message: %v", err)
+		sendError(client, message, CodeInternal, "Failed to send the message")
 	}
+}
 
-	// Expect Data to be an object with "content", "mediaType", and optionally "mediaURL"
-	dataMap, ok := message.Data.(map[string]interface{})
+func (h *Hub) handleIdeaSubmission(client *Client, message Message, data IdeaSubmissionData) {
+	session, ok := h.sessionFor(client, message)
 	if !ok {
-		log.Println("Invalid data for idea submission")
 		return
 	}
-	content, contentOk := dataMap["content"].(string)
-	mediaType, mtOk := dataMap["mediaType"].(string)
-	mediaURL, _ := dataMap["mediaURL"].(string)
-
-	if !contentOk || content == "" {
-		log.Println("Idea content is required")
+	sessionID := session.ID
+	if !session.GetPhase().AllowsIdeas() {
+		sendError(client, message, CodeWrongPhase, "Idea collection is closed for this session")
 		return
 	}
-	if !mtOk {
+	if data.Content == "" {
+		sendError(client, message, CodeInvalidData, "Idea content is required")
+		return
+	}
+	mediaType := data.MediaType
+	if mediaType == "" {
 		mediaType = "text"
 	}
+	if !validQuestion(session, data.GuidingQuestion) {
+		sendError(client, message, CodeInvalidData, "No such guiding question")
+		return
+	}
 
 	idea := &models.Idea{
 		ID:          generateSessionID(), // reuse session ID generator for idea IDs
-		Content:     content,
+		Content:     data.Content,
 		MediaType:   mediaType,
-		MediaURL:    mediaURL,
+		MediaURL:    data.MediaURL,
 		SubmittedBy: models.User{ID: client.userID, Username: message.Username},
 		Ratings:     []models.IdeaRating{},
+
+		GuidingQuestion: data.GuidingQuestion,
 	}
 
-	session, err := h.sessions.GetSession(sessionID)
-	if err != nil {
+	// The requestId lets the submitter replace the idea it showed as pending
+	if err := h.publish(models.EventIdeaSubmitted, sessionID, client.userID, models.IdeaSubmittedData{Idea: *idea},
+		func(*models.Session) (Message, bool) {
+			return Message{Type: "idea_submitted", RequestID: message.RequestID, Data: idea}, true
+		}); err != nil {
+		log.Printf("Error submitting idea: %v", err)
+		sendError(client, message, CodeInternal, "Failed to submit the idea")
 		return
 	}
-	session.AddIdea(idea)
-	response, _ := json.Marshal(Message{
-		Type: "idea_submitted",
-		Data: idea,
-	})
-	h.broadcastToSession(sessionID, response)
+	client.ack().IdeaID = idea.ID
 
-	submittedUsers := make(map[string]bool)
-	for _, idea := range session.Ideas {
-		submittedUsers[idea.SubmittedBy.ID] = true
+	if h.mediaProcessor != nil && (services.IsAudioType(mediaType) || services.IsVideoType(mediaType) ||
+		services.IsLinkType(mediaType)) {
+		go h.processIdeaMedia(sessionID, *idea)
 	}
-
-	if len(submittedUsers) >= len(session.Users) {
-		aggregateMsg := Message{
-			Type:      "auto_aggregate",
-			SessionID: sessionID,
-		}
-		h.handleAggregateIdeas(client, aggregateMsg)
+	if h.ideaIndex != nil {
+		go h.checkDuplicates(client, sessionID, *idea)
 	}
 }
 
-func (h *Hub) handleAggregateIdeas(client *Client, message Message) {
-	h.mutex.RLock()
-	sessionID, inSession := h.clientSessions[client]
-	h.mutex.RUnlock()
-	if !inSession || sessionID != message.SessionID {
+func (h *Hub) handleIdeaRating(client *Client, message Message, data IdeaRatingData) {
+	session, ok := h.sessionFor(client, message)
+	if !ok {
 		return
 	}
-	session, err := h.sessions.GetSession(sessionID)
-	if err != nil {
+	sessionID := session.ID
+	if !session.GetPhase().AllowsRatings() {
+		sendError(client, message, CodeWrongPhase, "Ideas can only be rated during the rating phase")
 		return
 	}
 
-	// First inform all clients that aggregation has started
-	startMsg, _ := json.Marshal(Message{
-		Type:      "aggregation_started",
-		SessionID: sessionID,
-		Data:      "Processing ideas ...",
-	})
-	h.broadcastToSession(sessionID, startMsg)
-
-	if h.mediaProcessor == nil {
-		errorMsg, _ := json.Marshal(Message{
-			Type:      "aggregation_error",
-			SessionID: sessionID,
-			Data:      "Media processor not configured",
-		})
-		h.broadcastToSession(sessionID, errorMsg)
+	if _, exists := session.GetIdea(data.IdeaID); !exists {
+		sendError(client, message, CodeNotFound, "Idea not found")
 		return
 	}
-
-	var items []struct {
-		MediaType string
-		MediaURL  string
-		Content   string
+	rating := models.IdeaRatedData{
+		IdeaID: data.IdeaID,
+		Rating: models.IdeaRating{
+			UserID:      client.userID,
+			Novelty:     data.Rating.Novelty,
+			Feasibility: data.Rating.Feasibility,
+			Usefulness:  data.Rating.Usefulness,
+			Comment:     data.Rating.Comment,
+		},
+	}
+	if err := rating.Rating.Validate(); err != nil {
+		sendError(client, message, CodeInvalidData, "Invalid rating: "+err.Error())
+		return
 	}
 
-	for _, idea := range session.Ideas {
-		items = append(items, struct {
-			MediaType string
-			MediaURL  string
-			Content   string
-		}{
-			MediaType: idea.MediaType,
-			MediaURL:  idea.MediaURL,
-			Content:   idea.Content,
-		})
+	if err := h.publish(models.EventIdeaRated, sessionID, client.userID, rating, ideaUpdate(rating.IdeaID)); err != nil {
+		log.Printf("Error recording idea rating: %v", err)
+		sendError(client, message, CodeInternal, "Failed to record the rating")
 	}
+}
 
-	go func() {
-		aggregatedContent, err := h.mediaProcessor.AggregateMedia(items)
+// ideaUpdate describes an event by the idea it changed, together with the
+// idea's current rating aggregates.
+func ideaUpdate(ideaID string) func(session *models.Session) (Message, bool) {
+	return func(session *models.Session) (Message, bool) {
+		idea, exists := session.GetIdea(ideaID)
+		if !exists {
+			return Message{}, false
+		}
+		scores, err := session.ScoreIdea(ideaID)
 		if err != nil {
-			log.Printf("Error during idea aggregation: %v", err)
-			errorMsg, _ := json.Marshal(Message{
-				Type:      "aggregation_error",
-				SessionID: sessionID,
-				Data:      "Failed to aggregate ideas: " + err.Error(),
-			})
-			h.broadcastToSession(sessionID, errorMsg)
-			return
+			return Message{}, false
 		}
-
-		aggregation, _ := json.Marshal(Message{
-			Type:      "aggregation_result",
-			SessionID: sessionID,
-			Data:      aggregatedContent,
-		})
-		h.broadcastToSession(sessionID, aggregation)
-	}()
+		return Message{
+			Type: "idea_updated",
+			Data: map[string]interface{}{
+				"idea":   idea,
+				"scores": scores,
+			},
+		}, true
+	}
 }
 
-func (h *Hub) handleIdeaRating(client *Client, message Message) {
-	h.mutex.RLock()
-	sessionID, inSession := h.clientSessions[client]
-	h.mutex.RUnlock()
-	if !inSession || sessionID != message.SessionID {
+func (h *Hub) handleChangePhase(client *Client, message Message, data ChangePhaseData) {
+	session, ok := h.sessionFor(client, message)
+	if !ok {
 		return
 	}
-	// Broadcast the rating; in a full implementation, you would update the corresponding idea.
-	ratingJSON, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("Error marshaling idea rating: %v", err)
+	sessionID := session.ID
+	next := data.Phase
+	current := session.GetPhase()
+	if err := current.CheckTransition(next); err != nil {
+		sendError(client, message, CodeWrongPhase, "Illegal phase change: "+err.Error())
 		return
 	}
-	h.broadcastToSession(sessionID, ratingJSON)
-}
 
-func (h *Hub) handleStartDiscussion(client *Client, message Message) {
-	h.mutex.RLock()
-	sessionID, inSession := h.clientSessions[client]
-	h.mutex.RUnlock()
-	if !inSession || sessionID != message.SessionID {
+	changed := models.PhaseChangedData{From: current, To: next}
+	if err := h.publish(models.EventPhaseChanged, sessionID, client.userID, changed,
+		func(*models.Session) (Message, bool) {
+			return Message{Type: "phase_changed", Data: changed}, true
+		}); err != nil {
+		log.Printf("Error changing phase: %v", err)
+		sendError(client, message, CodeInternal, "Failed to change the phase")
 		return
 	}
-	discussion, _ := json.Marshal(Message{
-		Type:      "discussion_started",
-		SessionID: sessionID,
-		Data:      "Group discussion phase has started. Please join the chat.",
-	})
-	h.broadcastToSession(sessionID, discussion)
+}
+
+// commit applies an accepted change to the session state and records it in
+// the journal. It only fails when the change was not applied; a failure to
+// journal it or save the session is logged so a storage hiccup does not
+// interrupt a live brainstorm.
+func (h *Hub) commit(eventType string, sessionID string, userID string, data interface{}) error {
+	h.commitMutex.Lock()
+	defer h.commitMutex.Unlock()
+	_, err := h.commitLocked(eventType, sessionID, userID, data)
+	return err
+}
+
+// publish commits an event and sends everyone in the session the message
+// describe builds from the changed session. The message carries the
+// event's seq and is kept for clients that resume. describe returns false
+// when there is nothing to send.
+func (h *Hub) publish(eventType string, sessionID string, userID string, data interface{},
+	describe func(session *models.Session) (Message, bool)) error {
+	h.commitMutex.Lock()
+	defer h.commitMutex.Unlock()
+	event, err := h.commitLocked(eventType, sessionID, userID, data)
+	if err != nil {
+		return err
+	}
+	session, err := h.sessions.GetSession(sessionID)
+	if err != nil {
+		return nil
+	}
+	message, ok := describe(session)
+	if !ok {
+		return nil
+	}
+	message.SessionID = sessionID
+	message.Seq = event.SessionSeq
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Error marshaling %s: %v", message.Type, err)
+		return nil
+	}
+	h.remember(sessionID, event.SessionSeq, encoded)
+	h.broadcastToSession(sessionID, encoded)
+	return nil
+}
+
+// commitLocked numbers the event within its session and commits it. The
+// caller holds commitMutex.
+func (h *Hub) commitLocked(eventType string, sessionID string, userID string, data interface{}) (models.Event, error) {
+	event, err := models.NewEvent(eventType, sessionID, userID, data)
+	if err != nil {
+		return event, err
+	}
+	event.SessionSeq = h.sessions.NextSeq(sessionID)
+	session, err := h.sessions.Apply(event)
+	if err != nil {
+		return event, err
+	}
+	// Only applied events are journaled, so a restart never replays one
+	// that was rejected
+	if h.journal != nil {
+		if err := h.journal.Append(&event); err != nil {
+			log.Printf("Error journaling %s event of session %s: %v", eventType, sessionID, err)
+		}
+	}
+	if eventType == models.EventSessionRemoved {
+		delete(h.backlogs, sessionID)
+		err = h.sessions.RemoveSession(sessionID)
+	} else if session != nil {
+		err = h.sessions.SaveSession(session)
+	}
+	if err != nil {
+		log.Printf("Error saving session %s: %v", sessionID, err)
+	}
+	return event, nil
 }
 
 func (h *Hub) broadcastSessionsList() {
@@ -484,3 +607,18 @@ func generateSessionID() string {
 func (h *Hub) SetMediaProcessor(processor *services.MediaProcessor) {
 	h.mediaProcessor = processor
 }
+
+// SetUsageMeter sets the meter that enforces session budgets and reports usage
+func (h *Hub) SetUsageMeter(meter *services.UsageMeter) {
+	h.usage = meter
+}
+
+// SetIdeaIndex sets the index used to spot duplicate ideas and cluster them
+func (h *Hub) SetIdeaIndex(index *services.IdeaIndex) {
+	h.ideaIndex = index
+}
+
+// SetJournal sets the append-only journal every accepted change is written to
+func (h *Hub) SetJournal(journal *models.Journal) {
+	h.journal = journal
+}
@@ -0,0 +1,172 @@
+// File: backend/websocket/hub_test.go
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"bhh-brainstorming/backend/models"
+	"bhh-brainstorming/backend/services"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestServer runs a hub that aggregates with the offline fake provider.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	processor := services.NewMediaProcessor(services.NewFakeProvider(), nil)
+	prompts, err := services.LoadPromptLibrary("")
+	if err != nil {
+		t.Fatalf("loading prompt templates: %v", err)
+	}
+	processor.Prompts = prompts
+
+	hub := NewHub(models.NewSessionManager())
+	hub.SetMediaProcessor(processor)
+	go hub.Run()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeWs(hub, w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func dial(t *testing.T, server *httptest.Server) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dialing the hub: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func send(t *testing.T, conn *websocket.Conn, message string) {
+	t.Helper()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+		t.Fatalf("sending %s: %v", message, err)
+	}
+}
+
+// expect reads messages until one of the given type arrives, failing on
+// errors and after a few seconds. data is decoded into the message's data.
+func expect(t *testing.T, conn *websocket.Conn, messageType string, data interface{}) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, raw, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for %s: %v", messageType, err)
+		}
+		var message struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(raw, &message); err != nil {
+			t.Fatalf("decoding %s: %v", raw, err)
+		}
+		if message.Type == "error" || message.Type == "aggregation_error" {
+			t.Fatalf("waiting for %s, got %s", messageType, raw)
+		}
+		if message.Type != messageType {
+			continue
+		}
+		if data != nil {
+			if err := json.Unmarshal(message.Data, data); err != nil {
+				t.Fatalf("decoding %s data: %v", messageType, err)
+			}
+		}
+		return
+	}
+}
+
+func TestSubmitAndAggregateWithFakeProvider(t *testing.T) {
+	server := newTestServer(t)
+	conn := dial(t, server)
+	expect(t, conn, "connected", nil)
+
+	send(t, conn, `{"type":"create_session","username":"alice","data":{"name":"Office","guidingQuestions":["How can we be greener?"]}}`)
+	var session models.Session
+	expect(t, conn, "session_created", &session)
+
+	for _, content := range []string{"Plant trees on the roof", "Share bikes between teams"} {
+		send(t, conn, `{"type":"idea_submission","sessionId":"`+session.ID+`","username":"alice","data":{"content":"`+content+`"}}`)
+		expect(t, conn, "idea_submitted", nil)
+	}
+
+	send(t, conn, `{"type":"aggregate_ideas","sessionId":"`+session.ID+`"}`)
+	var aggregation models.Aggregation
+	expect(t, conn, "aggregation_result", &aggregation)
+	if aggregation.Summary == "" {
+		t.Fatalf("aggregation has no summary")
+	}
+	if len(aggregation.IdeaIDs) != 2 {
+		t.Fatalf("aggregation covers ideas %v, want both", aggregation.IdeaIDs)
+	}
+}
+
+func TestResumeRejectedAfterJoining(t *testing.T) {
+	server := newTestServer(t)
+	conn := dial(t, server)
+	var connected ConnectedData
+	expect(t, conn, "connected", &connected)
+
+	send(t, conn, `{"type":"create_session","username":"alice","data":{"name":"Office","guidingQuestions":["How can we be greener?"]}}`)
+	var session models.Session
+	expect(t, conn, "session_created", &session)
+
+	send(t, conn, `{"type":"resume","sessionId":"`+session.ID+`","data":{"token":"`+connected.ResumeToken+`"}}`)
+	expectError(t, conn, CodeConflict, "resumed")
+}
+
+func TestTagIdeaRejectedWhenClosed(t *testing.T) {
+	server := newTestServer(t)
+	conn := dial(t, server)
+	expect(t, conn, "connected", nil)
+
+	send(t, conn, `{"type":"create_session","username":"alice","data":{"name":"Office","guidingQuestions":["How can we be greener?"]}}`)
+	var session models.Session
+	expect(t, conn, "session_created", &session)
+	send(t, conn, `{"type":"idea_submission","sessionId":"`+session.ID+`","username":"alice","data":{"content":"Plant trees on the roof"}}`)
+	var idea models.Idea
+	expect(t, conn, "idea_submitted", &idea)
+	send(t, conn, `{"type":"change_phase","sessionId":"`+session.ID+`","data":{"phase":"closed"}}`)
+	expect(t, conn, "phase_changed", nil)
+
+	send(t, conn, `{"type":"tag_idea","sessionId":"`+session.ID+`","data":{"ideaId":"`+idea.ID+`","guidingQuestion":1}}`)
+	expectError(t, conn, CodeWrongPhase, "idea_updated")
+}
+
+// expectError reads messages until an error arrives and checks its code,
+// failing if a message of the type success would bring arrives first.
+func expectError(t *testing.T, conn *websocket.Conn, code string, successType string) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var message struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("waiting for a %s error: %v", code, err)
+		}
+		if message.Type == successType {
+			t.Fatalf("waiting for a %s error, got %s", code, successType)
+		}
+		if message.Type == "error" {
+			var failure ErrorData
+			if err := json.Unmarshal(message.Data, &failure); err != nil {
+				t.Fatalf("decoding error: %v", err)
+			}
+			if failure.Code != code {
+				t.Fatalf("failed with %q (%s), want %q", failure.Code, failure.Message, code)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// File: backend/websocket/media.go
+package websocket
+
+import (
+	"bhh-brainstorming/backend/models"
+	"bhh-brainstorming/backend/services"
+	"context"
+	"log"
+	"time"
+)
+
+// mediaProcessingTimeout bounds the work done for a single submitted idea.
+const mediaProcessingTimeout = 5 * time.Minute
+
+// processIdeaMedia extracts text from a newly submitted audio, video or link idea,
+// stores it on the idea and publishes the updated idea to the session. Failures
+// are only logged; aggregation retries ideas that have no text yet.
+func (h *Hub) processIdeaMedia(sessionID string, idea models.Idea) {
+	session, err := h.sessions.GetSession(sessionID)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(h.usageContext(session), mediaProcessingTimeout)
+	defer cancel()
+
+	switch {
+	case services.IsAudioType(idea.MediaType):
+		var transcript string
+		transcript, err = h.mediaProcessor.ProcessMedia(ctx, idea.MediaType, idea.MediaURL, idea.Content)
+		if err == nil {
+			err = h.publish(models.EventIdeaTranscribed, sessionID, "",
+				models.IdeaTranscribedData{IdeaID: idea.ID, Transcript: transcript}, ideaUpdate(idea.ID))
+		}
+	case services.IsVideoType(idea.MediaType):
+		var description string
+		description, err = h.mediaProcessor.ProcessMedia(ctx, idea.MediaType, idea.MediaURL, idea.Content)
+		if err == nil {
+			err = h.publish(models.EventIdeaDescribed, sessionID, "",
+				models.IdeaDescribedData{IdeaID: idea.ID, Description: description}, ideaUpdate(idea.ID))
+		}
+	case services.IsLinkType(idea.MediaType):
+		var description string
+		var meta *models.LinkMeta
+		description, meta, err = h.mediaProcessor.DescribeLink(ctx, services.LinkURL(idea.MediaURL, idea.Content))
+		if err == nil {
+			err = h.publish(models.EventIdeaDescribed, sessionID, "",
+				models.IdeaDescribedData{IdeaID: idea.ID, Description: description, MediaMeta: meta}, ideaUpdate(idea.ID))
+		}
+	default:
+		return
+	}
+	if err != nil {
+		log.Printf("Error processing %s idea %s: %v", idea.MediaType, idea.ID, err)
+	}
+}
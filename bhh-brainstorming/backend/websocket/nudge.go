@@ -0,0 +1,81 @@
+// File: backend/websocket/nudge.go
+package websocket
+
+import (
+	"bhh-brainstorming/backend/models"
+	"bhh-brainstorming/backend/services"
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// nudgeTimeout bounds the model call behind one request_prompt.
+const nudgeTimeout = time.Minute
+
+// handleRequestPrompt asks the model for nudges for a participant who is
+// stuck. Only the participant who asked gets them.
+func (h *Hub) handleRequestPrompt(client *Client, message Message) {
+	session, ok := h.sessionFor(client, message)
+	if !ok {
+		return
+	}
+	if !session.GetPhase().AllowsIdeas() {
+		sendError(client, message, CodeWrongPhase, "Idea collection is closed for this session")
+		return
+	}
+	if !session.NudgesEnabled() {
+		sendError(client, message, CodeForbidden, "A facilitator turned off prompts for this session")
+		return
+	}
+	if h.mediaProcessor == nil {
+		sendError(client, message, CodeUnavailable, "Media processor not configured")
+		return
+	}
+	if !h.checkBudget(client, message, session) {
+		return
+	}
+
+	template, _ := h.mediaProcessor.Prompts.Get(session.PromptTemplate)
+	request := services.NudgeRequest{
+		Template: template,
+		Session:  services.SessionPromptData(session),
+		Ideas:    session.GetIdeas(),
+		UserID:   client.userID,
+	}
+	go h.sendNudges(client, message, session, request)
+}
+
+func (h *Hub) sendNudges(client *Client, message Message, session *models.Session, request services.NudgeRequest) {
+	ctx, cancel := context.WithTimeout(h.usageContext(session), nudgeTimeout)
+	defer cancel()
+
+	nudges, err := h.mediaProcessor.GenerateNudges(ctx, request)
+	if err != nil {
+		log.Printf("Error generating nudges for %s in session %s: %v", client.userID, session.ID, err)
+		h.sendToClient(client, session.ID, errorReply(message, CodeInternal, "Could not come up with prompts right now"))
+		return
+	}
+	reply, _ := json.Marshal(Message{
+		Type:      "nudges",
+		SessionID: session.ID,
+		Data:      nudges,
+	})
+	h.sendToClient(client, session.ID, reply)
+}
+
+func (h *Hub) handleSetNudges(client *Client, message Message, data SetNudgesData) {
+	session, ok := h.sessionFor(client, message)
+	if !ok {
+		return
+	}
+	if data.Enabled == nil {
+		sendError(client, message, CodeInvalidData, "Say whether prompts are enabled")
+		return
+	}
+
+	if err := h.publish(models.EventNudgesToggled, session.ID, client.userID, models.NudgesToggledData{Enabled: *data.Enabled}, sessionUpdate); err != nil {
+		log.Printf("Error changing prompt setting: %v", err)
+		sendError(client, message, CodeInternal, "Failed to change the prompt setting")
+	}
+}
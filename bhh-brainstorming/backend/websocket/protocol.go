@@ -0,0 +1,231 @@
+// File: backend/websocket/protocol.go
+package websocket
+
+import (
+	"bhh-brainstorming/backend/models"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// Codes of error replies, so clients can react without parsing the text.
+const (
+	CodeInvalidMessage = "invalid_message" // not a JSON message envelope
+	CodeUnknownType    = "unknown_type"    // no such message type
+	CodeInvalidData    = "invalid_data"    // payload malformed or out of range
+	CodeNotInSession   = "not_in_session"  // sent for a session the client is not in
+	CodeForbidden      = "forbidden"       // the client's role does not allow it
+	CodeNotFound       = "not_found"       // the session, idea or user does not exist
+	CodeWrongPhase     = "wrong_phase"     // not allowed in the session's phase
+	CodeConflict       = "conflict"        // clashes with work already under way
+	CodeBudgetExceeded = "budget_exceeded" // the session's AI budget is spent
+	CodeUnavailable    = "unavailable"     // the server is not set up for it
+	CodeInternal       = "internal"        // the server failed to carry it out
+)
+
+// ErrorData is the payload of an error reply. MessageType names the client
+// message that failed; the reply also echoes that message's requestId.
+type ErrorData struct {
+	Code        string `json:"code"`
+	Message     string `json:"message"`
+	MessageType string `json:"messageType,omitempty"`
+}
+
+// inboundMessage is a client message as received. Data is decoded later,
+// into the payload type of the message type.
+type inboundMessage struct {
+	Type      string          `json:"type"`
+	SessionID string          `json:"sessionId,omitempty"`
+	UserID    string          `json:"userId,omitempty"`
+	Username  string          `json:"username,omitempty"`
+	RequestID string          `json:"requestId,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+func (m inboundMessage) message() Message {
+	return Message{
+		Type:      m.Type,
+		SessionID: m.SessionID,
+		UserID:    m.UserID,
+		Username:  m.Username,
+		RequestID: m.RequestID,
+	}
+}
+
+// Payloads of client messages. Fields marked omitempty are optional.
+
+type CreateSessionData struct {
+	Name             string   `json:"name"`
+	GuidingQuestions []string `json:"guidingQuestions"`
+	PromptTemplate   string   `json:"promptTemplate,omitempty"`
+	Model            string   `json:"model,omitempty"`
+}
+
+type JoinSessionData struct {
+	Role models.SessionRole `json:"role,omitempty"` // only "observer" may be asked for
+}
+
+type IdeaSubmissionData struct {
+	Content         string `json:"content"`
+	MediaType       string `json:"mediaType,omitempty"` // "text" when absent
+	MediaURL        string `json:"mediaURL,omitempty"`
+	GuidingQuestion int    `json:"guidingQuestion,omitempty"`
+}
+
+type IdeaRatingData struct {
+	IdeaID string      `json:"ideaId"`
+	Rating RatingScore `json:"rating"`
+}
+
+// RatingScore is a rating as a client sends it; the rater is always the
+// sender.
+type RatingScore struct {
+	Novelty     int    `json:"novelty"`
+	Feasibility int    `json:"feasibility"`
+	Usefulness  int    `json:"usefulness"`
+	Comment     string `json:"comment,omitempty"`
+}
+
+type TagIdeaData struct {
+	IdeaID          string `json:"ideaId"`
+	GuidingQuestion int    `json:"guidingQuestion"`
+}
+
+type CancelAggregationData struct {
+	JobID string `json:"jobId,omitempty"`
+}
+
+// AggregationDiffData names the aggregations to compare. Without them the
+// latest run is compared with the one before it.
+type AggregationDiffData struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+type ChangePhaseData struct {
+	Phase models.SessionPhase `json:"phase"`
+}
+
+// UserTargetData names the user a kick_user or promote_user is about.
+type UserTargetData struct {
+	UserID string `json:"userId"`
+}
+
+type SetBudgetData struct {
+	Budget *float64 `json:"budget"`
+}
+
+type SetNudgesData struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// route decodes the payload of a message and hands it to its handler. It
+// only fails when the payload is invalid.
+type route func(h *Hub, client *Client, message Message, data json.RawMessage) error
+
+// routes maps every client message type to its handler.
+var routes = map[string]route{
+	"create_session":      withData((*Hub).handleCreateSession),
+	"join_session":        withData((*Hub).handleJoinSession),
+	"leave_session":       withoutData((*Hub).handleLeaveSession),
+	"list_sessions":       withoutData((*Hub).handleListSessions),
+	"session_message":     withData((*Hub).handleSessionMessage),
+	"idea_submission":     withData((*Hub).handleIdeaSubmission),
+	"aggregate_ideas":     withoutData((*Hub).handleAggregateIdeas),
+	"cancel_aggregation":  withData((*Hub).handleCancelAggregation),
+	"aggregation_status":  withoutData((*Hub).handleAggregationStatus),
+	"aggregation_history": withoutData((*Hub).handleAggregationHistory),
+	"aggregation_diff":    withData((*Hub).handleAggregationDiff),
+	"idea_rating":         withData((*Hub).handleIdeaRating),
+	"tag_idea":            withData((*Hub).handleTagIdea),
+	"cluster_ideas":       withoutData((*Hub).handleClusterIdeas),
+	"request_prompt":      withoutData((*Hub).handleRequestPrompt),
+	"set_nudges":          withData((*Hub).handleSetNudges),
+	"change_phase":        withData((*Hub).handleChangePhase),
+	"kick_user":           withData((*Hub).handleKickUser),
+	"promote_user":        withData((*Hub).handlePromoteUser),
+	"set_budget":          withData((*Hub).handleSetBudget),
+	"usage_report":        withoutData((*Hub).handleUsageReport),
+	"resume":              withData((*Hub).handleResume),
+}
+
+// withData routes a message whose payload decodes into T. The decoded
+// payload also replaces the message's Data.
+func withData[T any](handle func(h *Hub, client *Client, message Message, data T)) route {
+	return func(h *Hub, client *Client, message Message, raw json.RawMessage) error {
+		var data T
+		if err := decodeStrict(raw, &data); err != nil {
+			return err
+		}
+		message.Data = data
+		handle(h, client, message, data)
+		return nil
+	}
+}
+
+// withoutData routes a message that carries no payload.
+func withoutData(handle func(h *Hub, client *Client, message Message)) route {
+	return func(h *Hub, client *Client, message Message, raw json.RawMessage) error {
+		if len(raw) > 0 && !bytes.Equal(raw, []byte("null")) {
+			return errors.New("this message takes no data")
+		}
+		handle(h, client, message)
+		return nil
+	}
+}
+
+// decodeStrict unmarshals a single JSON value into v, rejecting fields v
+// does not have. Absent data leaves v at its zero value.
+func decodeStrict(raw []byte, v interface{}) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		return errors.New("unexpected data after the JSON value")
+	}
+	return nil
+}
+
+// errorReply builds the error reply to a client message.
+func errorReply(request Message, code string, text string) []byte {
+	reply, _ := json.Marshal(Message{
+		Type:      "error",
+		SessionID: request.SessionID,
+		RequestID: request.RequestID,
+		Data:      ErrorData{Code: code, Message: text, MessageType: request.Type},
+	})
+	return reply
+}
+
+// sendError answers a client message with an error. While the message is
+// being handled, this also keeps it from being acknowledged.
+func sendError(client *Client, request Message, code string, text string) {
+	if client.request != nil && client.request.message.Type == request.Type {
+		client.request.failed = true
+	}
+	client.send <- errorReply(request, code, text)
+}
+
+// sessionFor returns the session the client is in, replying with an error
+// unless it is the session the message is addressed to.
+func (h *Hub) sessionFor(client *Client, message Message) (*models.Session, bool) {
+	h.mutex.RLock()
+	sessionID, inSession := h.clientSessions[client]
+	h.mutex.RUnlock()
+	if !inSession || sessionID != message.SessionID {
+		sendError(client, message, CodeNotInSession, "You are not in that session")
+		return nil, false
+	}
+	session, err := h.sessions.GetSession(sessionID)
+	if err != nil {
+		sendError(client, message, CodeNotFound, "Session not found")
+		return nil, false
+	}
+	return session, true
+}
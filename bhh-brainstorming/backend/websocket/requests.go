@@ -0,0 +1,211 @@
+// File: backend/websocket/requests.go
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// requestTTL is how long the ack of a request is kept for retries.
+const requestTTL = 10 * time.Minute
+
+// maxRememberedRequests caps the requests kept per user; the oldest are
+// forgotten first.
+const maxRememberedRequests = 100
+
+// repeatableMessages are run again when retried instead of being answered
+// from the request log: they only read, or only affect the connection they
+// arrive on, so running them twice does no harm.
+var repeatableMessages = map[string]bool{
+	"join_session":        true,
+	"leave_session":       true,
+	"list_sessions":       true,
+	"aggregation_status":  true,
+	"aggregation_history": true,
+	"aggregation_diff":    true,
+	"request_prompt":      true,
+	"usage_report":        true,
+	"resume":              true,
+}
+
+// AckData is the payload of an ack reply, sent when a client message with
+// a requestId was carried out. It holds the IDs of whatever the message
+// created. Work that continues in the background, such as an aggregation,
+// may still fail later with an error echoing the same requestId.
+type AckData struct {
+	MessageType string `json:"messageType"`
+	SessionID   string `json:"sessionId,omitempty"` // of a created session
+	IdeaID      string `json:"ideaId,omitempty"`    // of a submitted idea
+	JobID       string `json:"jobId,omitempty"`     // of a started aggregation
+}
+
+// pendingRequest is the client message being handled. Handlers add what
+// they created to its ack; sendError marks it failed.
+type pendingRequest struct {
+	message Message
+	ack     AckData
+	failed  bool
+}
+
+// ack returns the ack of the message being handled, for handlers to add
+// the IDs of what they created to.
+func (c *Client) ack() *AckData {
+	if c.request == nil {
+		return &AckData{}
+	}
+	return &c.request.ack
+}
+
+// finishRequest answers the message just handled with an ack unless an
+// error was sent for it, and remembers the ack for retries.
+func (h *Hub) finishRequest(client *Client, request *pendingRequest) {
+	message := request.message
+	if message.RequestID == "" {
+		return
+	}
+	remember := !repeatableMessages[message.Type]
+	if request.failed {
+		// Let a retry run again; the cause may have been temporary
+		if remember {
+			h.requests.forget(client.userID, message.RequestID)
+		}
+		return
+	}
+	request.ack.MessageType = message.Type
+	ack, _ := json.Marshal(Message{
+		Type:      "ack",
+		SessionID: message.SessionID,
+		RequestID: message.RequestID,
+		Data:      request.ack,
+	})
+	if remember {
+		h.requests.finish(client.userID, message.RequestID, ack)
+	}
+	client.send <- ack
+}
+
+// replayRequest answers a retried message from the request log. It reports
+// false when the message is new and should be handled, in which case it is
+// logged as in progress.
+func (h *Hub) replayRequest(client *Client, message Message) bool {
+	if message.RequestID == "" || repeatableMessages[message.Type] {
+		return false
+	}
+	entry, seen := h.requests.begin(client.userID, message.RequestID, message.Type)
+	switch {
+	case !seen:
+		return false
+	case entry.messageType != message.Type:
+		sendError(client, message, CodeConflict, "That requestId was already used by a message of type "+entry.messageType)
+	case entry.ack == nil:
+		sendError(client, message, CodeConflict, "The request is still being processed")
+	default:
+		client.send <- entry.ack
+	}
+	return true
+}
+
+// requestLog remembers the acks of recent requests of each user, so a
+// client that retries a request it got no answer to does not carry it out
+// twice.
+type requestLog struct {
+	mutex     sync.Mutex
+	users     map[string]*userRequests
+	lastSweep time.Time
+}
+
+type userRequests struct {
+	entries map[string]*loggedRequest
+	order   []string // request IDs, oldest first
+}
+
+type loggedRequest struct {
+	messageType string
+	ack         []byte // nil while the request is being handled
+	at          time.Time
+}
+
+func newRequestLog() *requestLog {
+	return &requestLog{users: make(map[string]*userRequests), lastSweep: time.Now()}
+}
+
+// begin returns the logged request with the ID, or logs a new one in
+// progress and reports that it was not seen before.
+func (l *requestLog) begin(userID string, requestID string, messageType string) (loggedRequest, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+	if now.Sub(l.lastSweep) > requestTTL {
+		l.sweep(now)
+	}
+
+	user, ok := l.users[userID]
+	if !ok {
+		user = &userRequests{entries: make(map[string]*loggedRequest)}
+		l.users[userID] = user
+	}
+	if entry, ok := user.entries[requestID]; ok {
+		if now.Sub(entry.at) <= requestTTL {
+			return *entry, true
+		}
+		// Reused after it expired, so it is a new request
+		*entry = loggedRequest{messageType: messageType, at: now}
+		return loggedRequest{}, false
+	}
+	user.entries[requestID] = &loggedRequest{messageType: messageType, at: now}
+	user.order = append(user.order, requestID)
+	for len(user.order) > maxRememberedRequests {
+		delete(user.entries, user.order[0])
+		user.order = user.order[1:]
+	}
+	return loggedRequest{}, false
+}
+
+// finish stores the ack of a request begun earlier.
+func (l *requestLog) finish(userID string, requestID string, ack []byte) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if user, ok := l.users[userID]; ok {
+		if entry, ok := user.entries[requestID]; ok {
+			entry.ack = ack
+			entry.at = time.Now()
+		}
+	}
+}
+
+// forget drops a request, so a retry is handled as if it were new.
+func (l *requestLog) forget(userID string, requestID string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	user, ok := l.users[userID]
+	if !ok {
+		return
+	}
+	delete(user.entries, requestID)
+	for i, id := range user.order {
+		if id == requestID {
+			user.order = append(user.order[:i], user.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// sweep drops requests older than requestTTL, and users left without any.
+func (l *requestLog) sweep(now time.Time) {
+	for userID, user := range l.users {
+		kept := user.order[:0]
+		for _, id := range user.order {
+			if now.Sub(user.entries[id].at) > requestTTL {
+				delete(user.entries, id)
+			} else {
+				kept = append(kept, id)
+			}
+		}
+		user.order = kept
+		if len(user.order) == 0 {
+			delete(l.users, userID)
+		}
+	}
+	l.lastSweep = now
+}
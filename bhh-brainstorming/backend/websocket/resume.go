@@ -0,0 +1,314 @@
+// File: backend/websocket/resume.go
+package websocket
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// departureGrace is how long a user whose connection dropped stays in the
+// session, so a client that reconnects in time can resume where it was.
+const departureGrace = 2 * time.Minute
+
+// resumeTokenTTL is how long a resume token stays valid after the last
+// connection that used it closed.
+const resumeTokenTTL = 24 * time.Hour
+
+// backlogSize caps the messages kept per session for clients that resume.
+// A client that missed more gets a fresh copy of the session instead.
+const backlogSize = 500
+
+// ConnectedData is the payload of the connected message every client gets
+// first. The resume token lets a later connection take over the user ID.
+type ConnectedData struct {
+	UserID      string `json:"userId"`
+	ResumeToken string `json:"resumeToken"`
+}
+
+// ResumeData is the payload of a resume message. LastSeq is the highest
+// seq the client saw in the session the message is addressed to.
+type ResumeData struct {
+	Token   string `json:"token"`
+	LastSeq int64  `json:"lastSeq"`
+}
+
+// ResumedData ends a resume. Resync is set when the missed messages were no
+// longer kept and a session_joined with the whole session was sent instead.
+type ResumedData struct {
+	UserID   string `json:"userId"`
+	Seq      int64  `json:"seq"`
+	Replayed int    `json:"replayed"`
+	Resync   bool   `json:"resync,omitempty"`
+}
+
+// identity is the user a resume token stands for.
+type identity struct {
+	userID string
+	// clients counts the connections using the token; expires only applies
+	// once none are left.
+	clients int
+	expires time.Time
+}
+
+// identities maps resume tokens to the users they were issued for.
+type identities struct {
+	mutex  sync.Mutex
+	tokens map[string]*identity
+}
+
+func newIdentities() *identities {
+	return &identities{tokens: make(map[string]*identity)}
+}
+
+// issue creates a token for a newly connected client.
+func (ids *identities) issue(userID string) string {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		log.Printf("Error creating resume token: %v", err)
+	}
+	token := hex.EncodeToString(raw)
+
+	ids.mutex.Lock()
+	defer ids.mutex.Unlock()
+	now := time.Now()
+	for t, id := range ids.tokens {
+		if id.clients == 0 && now.After(id.expires) {
+			delete(ids.tokens, t)
+		}
+	}
+	ids.tokens[token] = &identity{userID: userID, clients: 1}
+	return token
+}
+
+// claim moves a client from the token it holds to the one it presented,
+// returning the user the new token stands for.
+func (ids *identities) claim(held string, presented string) (string, bool) {
+	ids.mutex.Lock()
+	defer ids.mutex.Unlock()
+	id, ok := ids.tokens[presented]
+	if !ok || (id.clients == 0 && time.Now().After(id.expires)) {
+		return "", false
+	}
+	if presented != held {
+		id.clients++
+		ids.release(held)
+	}
+	return id.userID, true
+}
+
+// disconnect starts the expiry of a token once its last client is gone.
+func (ids *identities) disconnect(token string) {
+	ids.mutex.Lock()
+	defer ids.mutex.Unlock()
+	ids.release(token)
+}
+
+func (ids *identities) release(token string) {
+	if id, ok := ids.tokens[token]; ok && id.clients > 0 {
+		id.clients--
+		if id.clients == 0 {
+			id.expires = time.Now().Add(resumeTokenTTL)
+		}
+	}
+}
+
+// backlog keeps the latest sequenced messages of each session.
+type backlog struct {
+	messages []sequencedMessage
+	// complete is the seq from which on every message is kept; clients
+	// that saw less than that cannot be caught up from the backlog.
+	complete int64
+}
+
+type sequencedMessage struct {
+	seq     int64
+	message []byte
+}
+
+// remember keeps a message sent to the session. Callers hold commitMutex,
+// so messages arrive in seq order.
+func (h *Hub) remember(sessionID string, seq int64, message []byte) {
+	b, ok := h.backlogs[sessionID]
+	if !ok {
+		b = &backlog{complete: seq - 1}
+		h.backlogs[sessionID] = b
+	}
+	b.messages = append(b.messages, sequencedMessage{seq: seq, message: message})
+	if len(b.messages) > backlogSize {
+		b.complete = b.messages[0].seq
+		b.messages = b.messages[1:]
+	}
+}
+
+// missed returns the messages of a session after lastSeq, or false when
+// some of them are no longer kept. Callers hold commitMutex.
+func (h *Hub) missed(sessionID string, lastSeq int64) ([][]byte, bool) {
+	b, ok := h.backlogs[sessionID]
+	if !ok || lastSeq < b.complete {
+		return nil, false
+	}
+	messages := [][]byte{}
+	for _, m := range b.messages {
+		if m.seq > lastSeq {
+			messages = append(messages, m.message)
+		}
+	}
+	return messages, true
+}
+
+// handleResume lets a reconnecting client take over the user ID of the
+// token it presents and, when the message names a session the user is
+// still in, rejoins it and replays every message sent there after lastSeq.
+func (h *Hub) handleResume(client *Client, message Message, data ResumeData) {
+	// Taking over another user would leave this connection's own user in
+	// its session with no departure scheduled
+	h.mutex.RLock()
+	_, inSession := h.clientSessions[client]
+	h.mutex.RUnlock()
+	if inSession {
+		sendError(client, message, CodeConflict, "Resume before joining a session")
+		return
+	}
+	userID, ok := h.identities.claim(client.token, data.Token)
+	if !ok {
+		sendError(client, message, CodeNotFound, "The resume token is unknown or expired")
+		return
+	}
+	h.mutex.Lock()
+	client.userID = userID
+	client.token = data.Token
+	h.mutex.Unlock()
+	if message.SessionID == "" {
+		h.sendResumed(client, message, ResumedData{UserID: userID})
+		return
+	}
+
+	session, err := h.sessions.GetSession(message.SessionID)
+	if err != nil {
+		sendError(client, message, CodeNotFound, "Session not found")
+		return
+	}
+	if !session.HasUser(userID) {
+		sendError(client, message, CodeNotFound, "You are no longer in that session; join it again")
+		return
+	}
+
+	// Hold commits back, so nothing is published between the replay and
+	// the live messages that follow it
+	h.commitMutex.Lock()
+	h.mutex.Lock()
+	h.clientSessions[client] = session.ID
+	h.mutex.Unlock()
+	resumed := ResumedData{UserID: userID, Seq: session.GetSeq()}
+	replay, complete := h.missed(session.ID, data.LastSeq)
+	if complete && data.LastSeq <= resumed.Seq {
+		for _, m := range replay {
+			client.send <- m
+		}
+		resumed.Replayed = len(replay)
+	} else {
+		joined, _ := json.Marshal(Message{
+			Type: "session_joined",
+			Data: session,
+		})
+		client.send <- joined
+		resumed.Resync = true
+	}
+	h.commitMutex.Unlock()
+	// Only now, so a departure already under way sees the client back
+	h.cancelDeparture(session.ID, userID)
+
+	h.sendResumed(client, message, resumed)
+	h.sendProgress(client, session.ID)
+}
+
+func (h *Hub) sendResumed(client *Client, message Message, data ResumedData) {
+	resumed, _ := json.Marshal(Message{
+		Type:      "resumed",
+		SessionID: message.SessionID,
+		Data:      data,
+	})
+	client.send <- resumed
+}
+
+// departureKey names a user whose connection to a session dropped.
+type departureKey struct {
+	sessionID string
+	userID    string
+}
+
+// scheduleDeparture removes a disconnected user from the session once the
+// grace period is over, unless they resumed or another of their
+// connections is still in it by then.
+func (h *Hub) scheduleDeparture(sessionID string, userID string) {
+	key := departureKey{sessionID: sessionID, userID: userID}
+	h.departuresMutex.Lock()
+	defer h.departuresMutex.Unlock()
+	if timer, ok := h.departures[key]; ok {
+		timer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(departureGrace, func() {
+		// A departure cancelled or scheduled anew meanwhile is not this one
+		h.departuresMutex.Lock()
+		current := h.departures[key] == timer
+		if current {
+			delete(h.departures, key)
+		}
+		h.departuresMutex.Unlock()
+		if !current || h.connected(sessionID, userID) {
+			return
+		}
+		h.removeUserFromSession(sessionID, userID)
+	})
+	h.departures[key] = timer
+}
+
+// scheduleRestoredDepartures treats every user of the sessions loaded at
+// startup as disconnected. Nobody can be connected yet, so users who do not
+// come back within the grace period leave, and sessions left empty are
+// removed instead of lingering forever.
+func (h *Hub) scheduleRestoredDepartures() {
+	for _, session := range h.sessions.ListSessions() {
+		for _, user := range session.GetUsers() {
+			h.scheduleDeparture(session.ID, user.ID)
+		}
+	}
+}
+
+// cancelDeparture keeps a user who is back in the session from being
+// removed.
+func (h *Hub) cancelDeparture(sessionID string, userID string) {
+	key := departureKey{sessionID: sessionID, userID: userID}
+	h.departuresMutex.Lock()
+	defer h.departuresMutex.Unlock()
+	if timer, ok := h.departures[key]; ok {
+		timer.Stop()
+		delete(h.departures, key)
+	}
+}
+
+// connected reports whether any connection of the user is in the session.
+func (h *Hub) connected(sessionID string, userID string) bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for client, sid := range h.clientSessions {
+		if sid == sessionID && client.userID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// sendConnected tells a new client its user ID and resume token.
+func (h *Hub) sendConnected(client *Client) {
+	connected, _ := json.Marshal(Message{
+		Type: "connected",
+		Data: ConnectedData{UserID: client.userID, ResumeToken: client.token},
+	})
+	client.send <- connected
+}
@@ -0,0 +1,132 @@
+// File: backend/websocket/roles.go
+package websocket
+
+import (
+	"bhh-brainstorming/backend/models"
+	"encoding/json"
+	"log"
+)
+
+// facilitatorMessages may only be sent by a facilitator of the session.
+var facilitatorMessages = map[string]bool{
+	"change_phase":       true,
+	"aggregate_ideas":    true,
+	"cancel_aggregation": true,
+	"kick_user":          true,
+	"promote_user":       true,
+	"set_budget":         true,
+	"cluster_ideas":      true,
+	"set_nudges":         true,
+}
+
+// contributorMessages are refused from observers.
+var contributorMessages = map[string]bool{
+	"session_message": true,
+	"idea_submission": true,
+	"idea_rating":     true,
+	"tag_idea":        true,
+	"request_prompt":  true,
+}
+
+// authorize checks the client's role in its session against the message
+// type and replies with an error when the action is not allowed. Messages
+// from clients outside a session are left to the handlers to reject.
+func (h *Hub) authorize(client *Client, message Message) bool {
+	needsFacilitator := facilitatorMessages[message.Type]
+	needsContributor := contributorMessages[message.Type]
+	if !needsFacilitator && !needsContributor {
+		return true
+	}
+
+	h.mutex.RLock()
+	sessionID, inSession := h.clientSessions[client]
+	h.mutex.RUnlock()
+	if !inSession {
+		return true
+	}
+	session, err := h.sessions.GetSession(sessionID)
+	if err != nil {
+		return true
+	}
+
+	role := session.GetRole(client.userID)
+	if needsFacilitator && !role.CanFacilitate() {
+		sendError(client, message, CodeForbidden, "Only facilitators can do that")
+		return false
+	}
+	if needsContributor && !role.CanContribute() {
+		sendError(client, message, CodeForbidden, "Observers cannot submit to this session")
+		return false
+	}
+	return true
+}
+
+func (h *Hub) handleKickUser(client *Client, message Message, data UserTargetData) {
+	session, ok := h.sessionFor(client, message)
+	if !ok {
+		return
+	}
+	sessionID, target := session.ID, data.UserID
+	if target == "" || !session.HasUser(target) {
+		sendError(client, message, CodeNotFound, "User not found in session")
+		return
+	}
+	if target == client.userID {
+		sendError(client, message, CodeInvalidData, "You cannot kick yourself")
+		return
+	}
+	if session.GetRole(target).CanFacilitate() {
+		sendError(client, message, CodeForbidden, "Facilitators cannot be kicked")
+		return
+	}
+
+	if err := h.publish(models.EventUserKicked, sessionID, client.userID, models.UserKickedData{UserID: target}, sessionUpdate); err != nil {
+		log.Printf("Error kicking user %s: %v", target, err)
+		sendError(client, message, CodeInternal, "Failed to remove the user")
+		return
+	}
+
+	h.cancelDeparture(sessionID, target)
+	kicked := []*Client{}
+	h.mutex.Lock()
+	for c, sid := range h.clientSessions {
+		if sid == sessionID && c.userID == target {
+			delete(h.clientSessions, c)
+			kicked = append(kicked, c)
+		}
+	}
+	h.mutex.Unlock()
+
+	notice, _ := json.Marshal(Message{
+		Type:      "kicked",
+		SessionID: sessionID,
+		Data:      "You were removed from the session by a facilitator",
+	})
+	for _, c := range kicked {
+		c.send <- notice
+	}
+}
+
+// handlePromoteUser makes a participant or observer a co-facilitator.
+func (h *Hub) handlePromoteUser(client *Client, message Message, data UserTargetData) {
+	session, ok := h.sessionFor(client, message)
+	if !ok {
+		return
+	}
+	sessionID, target := session.ID, data.UserID
+	if target == "" || !session.HasUser(target) {
+		sendError(client, message, CodeNotFound, "User not found in session")
+		return
+	}
+	if session.GetRole(target).CanFacilitate() {
+		sendError(client, message, CodeConflict, "User is already a facilitator")
+		return
+	}
+
+	// The new role reaches everyone with the session_updated it sends
+	change := models.RoleChangedData{UserID: target, Role: models.RoleFacilitator}
+	if err := h.publish(models.EventRoleChanged, sessionID, client.userID, change, sessionUpdate); err != nil {
+		log.Printf("Error promoting user %s: %v", target, err)
+		sendError(client, message, CodeInternal, "Failed to promote the user")
+	}
+}
@@ -0,0 +1,88 @@
+// File: backend/websocket/usage.go
+package websocket
+
+import (
+	"bhh-brainstorming/backend/models"
+	"bhh-brainstorming/backend/services"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+)
+
+// UsageStatus is the payload of a usage_report message: what the session's
+// AI calls have used so far, and its budget (0 when it has none).
+type UsageStatus struct {
+	services.UsageReport
+	Budget float64 `json:"budget"`
+}
+
+// usageContext returns a context that attributes model calls to the session
+// and holds them to its budget.
+func (h *Hub) usageContext(session *models.Session) context.Context {
+	return services.WithUsageScope(context.Background(), services.UsageScope{
+		SessionID: session.ID,
+		Budget:    session.GetBudget(),
+	})
+}
+
+// checkBudget refuses work for sessions that have spent their budget,
+// before anything is queued, and tells the client why.
+func (h *Hub) checkBudget(client *Client, message Message, session *models.Session) bool {
+	if h.usage == nil {
+		return true
+	}
+	err := h.usage.CheckBudget(session.ID, session.GetBudget())
+	if errors.Is(err, services.ErrBudgetExceeded) {
+		sendError(client, message, CodeBudgetExceeded, "The session's AI budget is used up")
+		return false
+	}
+	if err != nil {
+		log.Printf("Error checking budget of session %s: %v", session.ID, err)
+		sendError(client, message, CodeInternal, "Could not check the session's AI budget")
+		return false
+	}
+	return true
+}
+
+// handleSetBudget sets the session's budget in US dollars; 0 removes it.
+func (h *Hub) handleSetBudget(client *Client, message Message, data SetBudgetData) {
+	session, ok := h.sessionFor(client, message)
+	if !ok {
+		return
+	}
+	if data.Budget == nil || *data.Budget < 0 {
+		sendError(client, message, CodeInvalidData, "Budget must be a non-negative amount")
+		return
+	}
+
+	if err := h.publish(models.EventBudgetChanged, session.ID, client.userID, models.BudgetChangedData{Budget: *data.Budget}, sessionUpdate); err != nil {
+		log.Printf("Error changing budget: %v", err)
+		sendError(client, message, CodeInternal, "Failed to change the budget")
+	}
+}
+
+func (h *Hub) handleUsageReport(client *Client, message Message) {
+	session, ok := h.sessionFor(client, message)
+	if !ok {
+		return
+	}
+	sessionID := session.ID
+	if h.usage == nil {
+		sendError(client, message, CodeUnavailable, "Usage accounting is not configured")
+		return
+	}
+
+	reports, err := h.usage.Reports(sessionID)
+	if err != nil {
+		log.Printf("Error loading usage of session %s: %v", sessionID, err)
+		sendError(client, message, CodeInternal, "Could not load usage")
+		return
+	}
+	response, _ := json.Marshal(Message{
+		Type:      "usage_report",
+		SessionID: sessionID,
+		Data:      UsageStatus{UsageReport: reports[0], Budget: session.GetBudget()},
+	})
+	client.send <- response
+}
@@ -1,5 +1,6 @@
 import React from 'react';
 import { mediaService } from '../services/mediaservice';
+import { Aggregation, AggregationDiff, Idea } from '../services/websocketservice';
 import './MediaDisplay.css';
 
 interface MediaDisplayProps {
@@ -61,17 +62,173 @@ const MediaDisplay: React.FC<MediaDisplayProps> = ({ mediaType, mediaURL, conten
 };
 
 // Specialized component for displaying aggregation results
-export const AggregationDisplay: React.FC<{ content: string }> = ({ content }) => {
+interface AggregationDisplayProps {
+  aggregation: Aggregation;
+  ideas: Idea[];
+  guidingQuestions?: string[];
+  // Tags an idea with the guiding question suggested for it
+  onAcceptSuggestion?: (ideaId: string, question: number) => void;
+}
+
+export const AggregationDisplay: React.FC<AggregationDisplayProps> = ({
+  aggregation,
+  ideas,
+  guidingQuestions = [],
+  onAcceptSuggestion,
+}) => {
+  const ideaContent = (id: string) => ideas.find(idea => idea.id === id)?.content ?? id;
+  const suggestionFor = (id: string) => {
+    const suggestion = aggregation.suggestions?.find(s => s.ideaId === id);
+    // Ideas tagged since the aggregation ran no longer need a suggestion
+    const idea = ideas.find(i => i.id === id);
+    return suggestion && suggestion.question > 0 && !idea?.guidingQuestion ? suggestion.question : 0;
+  };
+
   return (
     <div className="aggregation-display">
       <h3>AI-Generated Summary</h3>
       <div className="aggregation-content">
-        {content.split('\n').map((line, index) => (
+        {aggregation.summary.split('\n').map((line, index) => (
           <p key={index}>{line}</p>
         ))}
+        {aggregation.themes.map((theme, index) => (
+          <div key={index} className="aggregation-theme">
+            <h4>{theme.title}</h4>
+            <p>{theme.summary}</p>
+            <ul className="theme-ideas">
+              {theme.ideaIds.map(id => (
+                <li key={id}>{ideaContent(id)}</li>
+              ))}
+            </ul>
+            {theme.pros.length > 0 && (
+              <>
+                <h5>Pros</h5>
+                <ul>{theme.pros.map((pro, i) => <li key={i}>{pro}</li>)}</ul>
+              </>
+            )}
+            {theme.cons.length > 0 && (
+              <>
+                <h5>Cons</h5>
+                <ul>{theme.cons.map((con, i) => <li key={i}>{con}</li>)}</ul>
+              </>
+            )}
+          </div>
+        ))}
+        {aggregation.sections && aggregation.sections.length > 1 && (
+          <div className="aggregation-sections">
+            <h4>By Guiding Question</h4>
+            {aggregation.sections.map(section => (
+              <div key={section.question} className="aggregation-section-question">
+                <h5>
+                  {section.question > 0
+                    ? `${section.question}. ${guidingQuestions[section.question - 1] ?? ''}`
+                    : 'Unassigned'}
+                </h5>
+                {section.summary && <p>{section.summary}</p>}
+                <ul className="theme-ideas">
+                  {(section.ideaIds ?? []).map(id => (
+                    <li key={id}>
+                      {ideaContent(id)}
+                      {suggestionFor(id) > 0 && (
+                        <>
+                          {' '}
+                          <em>(suggested)</em>
+                          {onAcceptSuggestion && (
+                            <button onClick={() => onAcceptSuggestion(id, suggestionFor(id))}>Accept</button>
+                          )}
+                        </>
+                      )}
+                    </li>
+                  ))}
+                </ul>
+              </div>
+            ))}
+          </div>
+        )}
+        {aggregation.openQuestions.length > 0 && (
+          <>
+            <h4>Open Questions</h4>
+            <ul>{aggregation.openQuestions.map((question, i) => <li key={i}>{question}</li>)}</ul>
+          </>
+        )}
+        {aggregation.actionItems.length > 0 && (
+          <>
+            <h4>Action Items</h4>
+            <ul>{aggregation.actionItems.map((item, i) => <li key={i}>{item}</li>)}</ul>
+          </>
+        )}
+        {aggregation.failedIdeas && aggregation.failedIdeas.length > 0 && (
+          <>
+            <h4>Skipped Ideas</h4>
+            <ul className="failed-ideas">
+              {aggregation.failedIdeas.map(failed => (
+                <li key={failed.ideaId}>
+                  {ideaContent(failed.ideaId)}: {failed.error}
+                </li>
+              ))}
+            </ul>
+          </>
+        )}
       </div>
     </div>
   );
 };
 
+interface AggregationHistoryProps {
+  history: Aggregation[];
+  diff: AggregationDiff | null;
+  ideas: Idea[];
+  onCompare: (from: string, to: string) => void;
+}
+
+// Lists earlier aggregations and shows how each run differs from the one before.
+export const AggregationHistoryDisplay: React.FC<AggregationHistoryProps> = ({ history, diff, ideas, onCompare }) => {
+  const ideaContent = (id: string) => ideas.find(idea => idea.id === id)?.content ?? id;
+  const listChanges = (label: string, added: string[], removed: string[], render = (s: string) => s) =>
+    added.length + removed.length > 0 && (
+      <li>
+        {label}:{' '}
+        {added.map(entry => `+ ${render(entry)}`).concat(removed.map(entry => `- ${render(entry)}`)).join('; ')}
+      </li>
+    );
+
+  return (
+    <div className="aggregation-history">
+      <h4>Aggregation History</h4>
+      <ol>
+        {history.map((run, index) => (
+          <li key={run.id ?? index}>
+            {new Date(run.createdAt).toLocaleString()} · {run.model ?? 'unknown model'}
+            {run.promptVersion && ` · ${run.promptTemplate ?? 'prompt'} v${run.promptVersion}`} · {run.ideaIds?.length ?? '?'} ideas
+            {index > 0 && run.id && history[index - 1].id && (
+              <button onClick={() => onCompare(history[index - 1].id!, run.id!)}>Compare with previous</button>
+            )}
+          </li>
+        ))}
+      </ol>
+      {diff && (
+        <ul className="aggregation-diff">
+          {diff.summaryChanged && <li>The summary changed.</li>}
+          {listChanges('New ideas', diff.addedIdeaIds, diff.removedIdeaIds, ideaContent)}
+          {diff.addedThemes.map(theme => <li key={'+' + theme.title}>New theme: {theme.title}</li>)}
+          {diff.removedThemes.map(theme => <li key={'-' + theme.title}>Removed theme: {theme.title}</li>)}
+          {diff.changedThemes.map(change => (
+            <li key={'~' + change.title}>
+              Changed theme: {change.previousTitle ? `${change.previousTitle} → ${change.title}` : change.title}
+              <ul>
+                {change.summaryChanged && <li>Summary changed</li>}
+                {listChanges('Ideas', change.addedIdeaIds, change.removedIdeaIds, ideaContent)}
+                {listChanges('Pros', change.addedPros, change.removedPros)}
+                {listChanges('Cons', change.addedCons, change.removedCons)}
+              </ul>
+            </li>
+          ))}
+          {listChanges('Open questions', diff.addedOpenQuestions, diff.removedOpenQuestions)}
+          {listChanges('Action items', diff.addedActionItems, diff.removedActionItems)}
+        </ul>
+      )}
+    </div>
+  );
+};
+
 export default MediaDisplay; 
\ No newline at end of file
@@ -5,12 +5,15 @@ import './MediaUploader.css';
 interface MediaUploaderProps {
   onMediaUploaded: (mediaType: string, mediaURL: string, content: string) => void;
   sessionId: string;
+  guidingQuestions?: string[];
 }
 
-const MediaUploader: React.FC<MediaUploaderProps> = ({ onMediaUploaded, sessionId }) => {
+const MediaUploader: React.FC<MediaUploaderProps> = ({ onMediaUploaded, sessionId, guidingQuestions = [] }) => {
   const [isUploading, setIsUploading] = useState(false);
   const [content, setContent] = useState('');
   const [selectedFile, setSelectedFile] = useState<File | null>(null);
+  // 0 leaves the idea untagged
+  const [guidingQuestion, setGuidingQuestion] = useState(0);
   const [previewUrl, setPreviewUrl] = useState<string | null>(null);
   const [error, setError] = useState<string | null>(null);
   const fileInputRef = useRef<HTMLInputElement>(null);
@@ -72,7 +75,7 @@ const MediaUploader: React.FC<MediaUploaderProps> = ({ onMediaUploaded, sessionI
     setError(null);
     
     try {
-      await mediaService.submitIdeaWithMedia(sessionId, content, selectedFile || undefined);
+      await mediaService.submitIdeaWithMedia(sessionId, content, selectedFile || undefined, guidingQuestion || undefined);
       
       // Reset form
       setContent('');
@@ -110,6 +113,25 @@ const MediaUploader: React.FC<MediaUploaderProps> = ({ onMediaUploaded, sessionI
         />
       </div>
       
+      {guidingQuestions.length > 0 && (
+        <div className="input-group">
+          <label htmlFor="guiding-question">Answers guiding question (optional):</label>
+          <select
+            id="guiding-question"
+            value={guidingQuestion}
+            onChange={e => setGuidingQuestion(Number(e.target.value))}
+            disabled={isUploading}
+          >
+            <option value={0}>None</option>
+            {guidingQuestions.map((question, index) => (
+              <option key={index} value={index + 1}>
+                {index + 1}. {question}
+              </option>
+            ))}
+          </select>
+        </div>
+      )}
+
       <div className="input-group">
         <label htmlFor="file-upload">Add media (optional):</label>
         <input
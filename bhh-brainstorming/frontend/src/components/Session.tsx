@@ -1,7 +1,8 @@
 import React, { useState, useEffect, useRef } from 'react';
-import { websocketService, ISession, Message, Idea } from '../services/websocketservice';
+import { websocketService, ISession, Message, ErrorData, Idea, pendingIdeaId, IdeaScores, SessionPhase, Aggregation, AggregationStage, AggregationJob, AggregationDiff, UsageReport, IdeaClustering, DuplicateWarning, Nudge } from '../services/websocketservice';
+import { mediaService, PromptOptions } from '../services/mediaservice';
 import MediaUploader from './MediaUploader';
-import MediaDisplay, { AggregationDisplay } from './MediaDisplay';
+import MediaDisplay, { AggregationDisplay, AggregationHistoryDisplay } from './MediaDisplay';
 import './Session.css';
 
 interface Rating {
@@ -16,11 +17,24 @@ const Session: React.FC = () => {
   const [connected, setConnected] = useState(false);
   const [sessionName, setSessionName] = useState('');
   const [guidingQuestions, setGuidingQuestions] = useState('');
+  const [promptOptions, setPromptOptions] = useState<PromptOptions | null>(null);
+  const [promptTemplate, setPromptTemplate] = useState('');
+  const [model, setModel] = useState('');
   const [sessions, setSessions] = useState<ISession[]>([]);
   const [currentSessionId, setCurrentSessionId] = useState('');
   const [chatMessages, setChatMessages] = useState<Message[]>([]);
   const [inputMessage, setInputMessage] = useState('');
-  const [aggregatedResult, setAggregatedResult] = useState('');
+  const [aggregation, setAggregation] = useState<Aggregation | null>(null);
+  // Raw model output received so far while an aggregation is running
+  const [streamedText, setStreamedText] = useState('');
+  const [aggregationStage, setAggregationStage] = useState<AggregationStage | null>(null);
+  const [aggregationJob, setAggregationJob] = useState<AggregationJob | null>(null);
+  const [aggregationHistory, setAggregationHistory] = useState<Aggregation[]>([]);
+  const [aggregationDiff, setAggregationDiff] = useState<AggregationDiff | null>(null);
+  const [usage, setUsage] = useState<UsageReport | null>(null);
+  const [budgetInput, setBudgetInput] = useState('');
+  const [duplicateWarning, setDuplicateWarning] = useState<DuplicateWarning | null>(null);
+  const [nudges, setNudges] = useState<Nudge[]>([]);
   const [rating, setRating] = useState<Rating>({ novelty: 1, feasibility: 1, usefulness: 1 });
   const [selectedIdeaId, setSelectedIdeaId] = useState<string | null>(null);
   const [discussionStarted, setDiscussionStarted] = useState(false);
@@ -34,6 +48,9 @@ const Session: React.FC = () => {
     currentSessionIdRef.current = currentSessionId;
   }, [currentSessionId]);
 
+  // Sequence number of the last aggregation chunk applied to streamedText
+  const aggregationSeqRef = useRef(0);
+
   const generateUsername = (): string => {
     const letters = 'abcdefghijklmnopqrstuvwxyz';
     let word = '';
@@ -45,17 +62,15 @@ const Session: React.FC = () => {
   };
 
   // Listener to update idea ratings in state when an idea rating message is received.
-  const handleIdeaRating = (data: any) => {
-    // Expect data to have ideaId and rating info.
+  const handleIdeaUpdated = (data: { idea: Idea; scores: IdeaScores }) => {
+    // Replace the idea with the server's copy, which carries every rating.
     setSessions(prev =>
       prev.map(session =>
         session.id === currentSessionIdRef.current
           ? {
               ...session,
               ideas: session.ideas.map(idea =>
-                idea.id === data.ideaId
-                  ? { ...idea, ratings: [...idea.ratings, data.rating] }
-                  : idea
+                idea.id === data.idea.id ? { ...data.idea, scores: data.scores } : idea
               ),
             }
           : session
@@ -72,11 +87,17 @@ const Session: React.FC = () => {
 
     const handleSessionCreated = (data: ISession) => {
       setCurrentSessionId(data.id);
+      setAggregationHistory([]);
+      setAggregationDiff(null);
+      setUsage(null);
       setSessions(prev => [data, ...prev.filter(s => s.id !== data.id)]);
     };
 
     const handleSessionJoined = (data: { id: string }) => {
       setCurrentSessionId(data.id);
+      setAggregationDiff(null);
+      websocketService.requestAggregationHistory(data.id);
+      websocketService.requestUsageReport(data.id);
     };
 
     const handleSessionUpdated = (data: ISession) => {
@@ -87,26 +108,120 @@ const Session: React.FC = () => {
       setChatMessages(prev => [...prev, { type: 'session_message', data }]);
     };
 
-    // When an idea is submitted, update the session's ideas array.
-    const handleIdeaSubmitted = (idea: any) => {
+    // When an idea is submitted, update the session's ideas array. Our own
+    // ideas replace the pending placeholder shown while they were sent.
+    const handleIdeaSubmitted = (idea: any, message: Message) => {
+      const placeholder = message.requestId ? pendingIdeaId(message.requestId) : '';
       setSessions(prev =>
         prev.map(session =>
           session.id === currentSessionIdRef.current
-            ? { ...session, ideas: [...session.ideas, idea] }
+            ? {
+                ...session,
+                ideas: [...session.ideas.filter(i => i.id !== placeholder && i.id !== idea.id), idea],
+              }
             : session
         )
       );
       setChatMessages(prev => [...prev, { type: 'idea_submitted', data: idea }]);
     };
 
+    const handleIdeaPending = (idea: Idea) => {
+      setSessions(prev =>
+        prev.map(session =>
+          session.id === currentSessionIdRef.current
+            ? { ...session, ideas: [...session.ideas, idea] }
+            : session
+        )
+      );
+    };
+
+    // The server answered, so drop the placeholder if the idea did not
+    // replace it; a failure is shown by handleError.
+    const handleIdeaSettled = (data: { requestId: string }) => {
+      const placeholder = pendingIdeaId(data.requestId);
+      setSessions(prev =>
+        prev.map(session => ({ ...session, ideas: session.ideas.filter(i => i.id !== placeholder) }))
+      );
+    };
+
     const handleAggregationStarted = (data: any) => {
       setIsAggregating(true);
+      setStreamedText('');
+      setAggregationStage(null);
+      aggregationSeqRef.current = 0;
       setChatMessages(prev => [...prev, { type: 'aggregation_started', data }]);
     };
 
-    const handleAggregationResult = (data: string) => {
-      setAggregatedResult(data);
+    const handleAggregationChunk = (data: { seq: number; delta: string }) => {
+      if (data.seq <= aggregationSeqRef.current) return;
+      aggregationSeqRef.current = data.seq;
+      setStreamedText(prev => prev + data.delta);
+    };
+
+    // Sent when joining mid-aggregation with the text streamed so far.
+    const handleAggregationProgress = (data: { seq: number; text: string }) => {
+      aggregationSeqRef.current = data.seq;
+      setStreamedText(data.text);
+      setIsAggregating(true);
+    };
+
+    const handleAggregationStage = (data: AggregationStage) => {
+      setAggregationStage(data);
+    };
+
+    const handleAggregationHistory = (data: Aggregation[]) => {
+      setAggregationHistory(data);
+    };
+
+    const handleAggregationDiff = (data: AggregationDiff) => {
+      setAggregationDiff(data);
+    };
+
+    // Status of the session's aggregation job; absent when there is none.
+    const handleAggregationJob = (data?: AggregationJob) => {
+      setAggregationJob(data ?? null);
+      if (!data) return;
+      setIsAggregating(data.state === 'queued' || data.state === 'running');
+      if (data.stage) setAggregationStage(data.stage);
+      if (data.state === 'cancelled') {
+        setStreamedText('');
+        setChatMessages(prev => [...prev, { type: 'aggregation_cancelled', data: 'Aggregation was cancelled.' }]);
+      }
+    };
+
+    const handleAggregationResult = (data: Aggregation) => {
+      setAggregation(data);
+      setAggregationHistory(prev => [...prev.filter(run => run.id !== data.id), data]);
+      setStreamedText('');
       setIsAggregating(false);
+      websocketService.requestUsageReport(currentSessionIdRef.current);
+    };
+
+    const handleUsageReport = (data: UsageReport) => {
+      setUsage(data);
+    };
+
+    const handlePossibleDuplicates = (data: DuplicateWarning) => {
+      setDuplicateWarning(data);
+    };
+
+    const handleNudges = (data: Nudge[]) => {
+      setNudges(data);
+    };
+
+    const handleIdeasClustered = (data: IdeaClustering) => {
+      setSessions(prev =>
+        prev.map(session =>
+          session.id === currentSessionIdRef.current ? { ...session, clustering: data } : session
+        )
+      );
+    };
+
+    const handleError = (data: ErrorData) => {
+      if (data.messageType === 'aggregate_ideas') {
+        setIsAggregating(false);
+      }
+      setChatMessages(prev => [...prev, { type: 'error', data: data.message }]);
     };
 
     const handleAggregationError = (data: any) => {
@@ -114,9 +229,19 @@ const Session: React.FC = () => {
       setChatMessages(prev => [...prev, { type: 'error', data }]);
     };
 
-    const handleDiscussionStarted = (data: any) => {
-      setDiscussionStarted(true);
-      setChatMessages(prev => [...prev, { type: 'discussion', data }]);
+    const handlePhaseChanged = (data: { from: SessionPhase; to: SessionPhase }) => {
+      setSessions(prev =>
+        prev.map(session =>
+          session.id === currentSessionIdRef.current ? { ...session, phase: data.to } : session
+        )
+      );
+      if (data.to === 'discuss') {
+        setDiscussionStarted(true);
+        setChatMessages(prev => [
+          ...prev,
+          { type: 'discussion', data: 'Group discussion phase has started. Please join the chat.' },
+        ]);
+      }
     };
 
     websocketService.on('sessions_list', handleSessionsList);
@@ -125,11 +250,24 @@ const Session: React.FC = () => {
     websocketService.on('session_updated', handleSessionUpdated);
     websocketService.on('session_message', handleSessionMessage);
     websocketService.on('idea_submitted', handleIdeaSubmitted);
+    websocketService.on('idea_pending', handleIdeaPending);
+    websocketService.on('idea_settled', handleIdeaSettled);
     websocketService.on('aggregation_started', handleAggregationStarted);
+    websocketService.on('aggregation_chunk', handleAggregationChunk);
+    websocketService.on('aggregation_progress', handleAggregationProgress);
+    websocketService.on('aggregation_stage', handleAggregationStage);
+    websocketService.on('aggregation_job', handleAggregationJob);
+    websocketService.on('aggregation_history', handleAggregationHistory);
+    websocketService.on('aggregation_diff', handleAggregationDiff);
     websocketService.on('aggregation_result', handleAggregationResult);
     websocketService.on('aggregation_error', handleAggregationError);
-    websocketService.on('discussion_started', handleDiscussionStarted);
-    websocketService.on('idea_rating', handleIdeaRating);
+    websocketService.on('usage_report', handleUsageReport);
+    websocketService.on('possible_duplicates', handlePossibleDuplicates);
+    websocketService.on('ideas_clustered', handleIdeasClustered);
+    websocketService.on('nudges', handleNudges);
+    websocketService.on('phase_changed', handlePhaseChanged);
+    websocketService.on('idea_updated', handleIdeaUpdated);
+    websocketService.on('error', handleError);
 
     return () => {
       websocketService.off('sessions_list', handleSessionsList);
@@ -138,24 +276,41 @@ const Session: React.FC = () => {
       websocketService.off('session_updated', handleSessionUpdated);
       websocketService.off('session_message', handleSessionMessage);
       websocketService.off('idea_submitted', handleIdeaSubmitted);
+      websocketService.off('idea_pending', handleIdeaPending);
+      websocketService.off('idea_settled', handleIdeaSettled);
       websocketService.off('aggregation_started', handleAggregationStarted);
+      websocketService.off('aggregation_chunk', handleAggregationChunk);
+      websocketService.off('aggregation_progress', handleAggregationProgress);
+      websocketService.off('aggregation_stage', handleAggregationStage);
+      websocketService.off('aggregation_job', handleAggregationJob);
+      websocketService.off('aggregation_history', handleAggregationHistory);
+      websocketService.off('aggregation_diff', handleAggregationDiff);
       websocketService.off('aggregation_result', handleAggregationResult);
       websocketService.off('aggregation_error', handleAggregationError);
-      websocketService.off('discussion_started', handleDiscussionStarted);
-      websocketService.off('idea_rating', handleIdeaRating);
+      websocketService.off('usage_report', handleUsageReport);
+      websocketService.off('possible_duplicates', handlePossibleDuplicates);
+      websocketService.off('ideas_clustered', handleIdeasClustered);
+      websocketService.off('nudges', handleNudges);
+      websocketService.off('phase_changed', handlePhaseChanged);
+      websocketService.off('idea_updated', handleIdeaUpdated);
+      websocketService.off('error', handleError);
     };
   }, []);
 
   const handleConnect = () => {
     if (username.trim() !== '') {
       websocketService.connect(username).then(() => setConnected(true));
+      mediaService
+        .getPromptOptions()
+        .then(setPromptOptions)
+        .catch(error => console.error('Error loading prompt options:', error));
     }
   };
 
   const handleCreateSession = () => {
     if (sessionName.trim() !== '' && guidingQuestions.trim() !== '') {
       const questions = guidingQuestions.split('\n').filter(q => q.trim() !== '');
-      websocketService.createSession(sessionName, questions);
+      websocketService.createSession(sessionName, questions, promptTemplate || undefined, model || undefined);
     }
   };
 
@@ -167,10 +322,14 @@ const Session: React.FC = () => {
     if (currentSessionId) {
       websocketService.leaveSession();
       setCurrentSessionId('');
-      setAggregatedResult('');
+      setAggregation(null);
+      setStreamedText('');
       setDiscussionStarted(false);
       setChatMessages([]);
       setIsAggregating(false);
+      setUsage(null);
+      setDuplicateWarning(null);
+      setNudges([]);
     }
   };
 
@@ -194,6 +353,62 @@ const Session: React.FC = () => {
     }
   };
 
+  const handleCloseCollection = () => {
+    if (currentSessionId) {
+      websocketService.changePhase(currentSessionId, 'rate');
+    }
+  };
+
+  const handleAggregateIdeas = () => {
+    if (currentSessionId) {
+      websocketService.aggregateIdeas(currentSessionId);
+    }
+  };
+
+  const handleCancelAggregation = () => {
+    if (currentSessionId) {
+      websocketService.cancelAggregation(currentSessionId, aggregationJob?.id);
+    }
+  };
+
+  const handleAcceptSuggestion = (ideaId: string, question: number) => {
+    if (currentSessionId) {
+      websocketService.tagIdea(currentSessionId, ideaId, question);
+    }
+  };
+
+  const handleRequestPrompt = () => {
+    if (currentSessionId) {
+      websocketService.requestPrompt(currentSessionId);
+    }
+  };
+
+  const handleToggleNudges = (enabled: boolean) => {
+    if (currentSessionId) {
+      websocketService.setNudges(currentSessionId, enabled);
+    }
+  };
+
+  const handleClusterIdeas = () => {
+    if (currentSessionId) {
+      websocketService.clusterIdeas(currentSessionId);
+    }
+  };
+
+  const handleCompareAggregations = (from: string, to: string) => {
+    if (currentSessionId) {
+      websocketService.compareAggregations(currentSessionId, from, to);
+    }
+  };
+
+  const handleSetBudget = () => {
+    const budget = Number(budgetInput);
+    if (currentSessionId && budgetInput.trim() !== '' && budget >= 0) {
+      websocketService.setBudget(currentSessionId, budget);
+      setBudgetInput('');
+    }
+  };
+
   const handleStartDiscussion = () => {
     if (currentSessionId) {
       websocketService.startDiscussion(currentSessionId);
@@ -201,7 +416,9 @@ const Session: React.FC = () => {
   };
 
   const currentSession = sessions.find(session => session.id === currentSessionId);
+  const shownAggregation = aggregation ?? currentSession?.aggregation;
   const selectedIdea = currentSession?.ideas.find(idea => idea.id === selectedIdeaId);
+  const ideaContent = (ideaId: string) => currentSession?.ideas.find(idea => idea.id === ideaId)?.content ?? ideaId;
 
   // Compute average ratings and collate comments for selected idea.
   let averageNovelty = 0,
@@ -247,6 +464,26 @@ const Session: React.FC = () => {
                 value={guidingQuestions}
                 onChange={e => setGuidingQuestions(e.target.value)}
               ></textarea>
+              {promptOptions && (
+                <div className="session-options">
+                  <select value={promptTemplate} onChange={e => setPromptTemplate(e.target.value)}>
+                    <option value="">Prompt template: {promptOptions.defaultTemplate}</option>
+                    {promptOptions.templates.map(template => (
+                      <option key={template.name} value={template.name}>
+                        {template.name} (v{template.version})
+                      </option>
+                    ))}
+                  </select>
+                  <select value={model} onChange={e => setModel(e.target.value)}>
+                    <option value="">Model: {promptOptions.defaultModel}</option>
+                    {promptOptions.models.map(name => (
+                      <option key={name} value={name}>
+                        {name}
+                      </option>
+                    ))}
+                  </select>
+                </div>
+              )}
               <button onClick={handleCreateSession}>Create Session</button>
             </div>
           )}
@@ -296,10 +533,52 @@ const Session: React.FC = () => {
                   </div>
                 )}
               </div>
-              {!discussionStarted && (
+              {currentSession?.phase === 'collect' && (
                 <div className="idea-submission">
                   <h3>Share Your Ideas</h3>
-                  <MediaUploader onMediaUploaded={handleMediaUploaded} sessionId={currentSessionId} />
+                  <MediaUploader
+                    onMediaUploaded={handleMediaUploaded}
+                    sessionId={currentSessionId}
+                    guidingQuestions={currentSession.guidingQuestions}
+                  />
+                  {duplicateWarning && (
+                    <div className="duplicate-warning">
+                      <p>Your idea looks a lot like:</p>
+                      <ul>
+                        {duplicateWarning.duplicates.map(duplicate => (
+                          <li key={duplicate.ideaId}>
+                            {ideaContent(duplicate.ideaId)} ({Math.round(duplicate.similarity * 100)}% similar)
+                          </li>
+                        ))}
+                      </ul>
+                      <button onClick={() => setDuplicateWarning(null)}>Dismiss</button>
+                    </div>
+                  )}
+                  {!currentSession.nudgesDisabled && (
+                    <button onClick={handleRequestPrompt}>I'm Stuck</button>
+                  )}
+                  {nudges.length > 0 && (
+                    <div className="nudges">
+                      <ul>
+                        {nudges.map((nudge, idx) => (
+                          <li key={idx}>
+                            <strong>{nudge.technique}:</strong> {nudge.text}
+                            {nudge.ideaId && <em> (builds on: {ideaContent(nudge.ideaId)})</em>}
+                            {!!nudge.guidingQuestion && <em> (question {nudge.guidingQuestion})</em>}
+                          </li>
+                        ))}
+                      </ul>
+                      <button onClick={() => setNudges([])}>Dismiss</button>
+                    </div>
+                  )}
+                  <label className="nudge-setting">
+                    <input
+                      type="checkbox"
+                      checked={!currentSession.nudgesDisabled}
+                      onChange={e => handleToggleNudges(e.target.checked)}
+                    />
+                    Allow AI prompts for stuck participants
+                  </label>
                 </div>
               )}
               {currentSession && (
@@ -311,10 +590,15 @@ const Session: React.FC = () => {
                         {currentSession.ideas.map((idea: Idea) => (
                           <div
                             key={idea.id}
-                            className="idea-card"
-                            onClick={() => setSelectedIdeaId(idea.id)}
+                            className={idea.pending ? 'idea-card idea-pending' : 'idea-card'}
+                            onClick={() => !idea.pending && setSelectedIdeaId(idea.id)}
                           >
                             <MediaDisplay mediaType={idea.mediaType} mediaURL={idea.mediaURL} content={idea.content} />
+                            {idea.transcript && <p className="idea-transcript">{idea.transcript}</p>}
+                            {idea.description && <p className="idea-transcript">{idea.description}</p>}
+                            {!!idea.guidingQuestion && (
+                              <p className="idea-question">Answers question {idea.guidingQuestion}</p>
+                            )}
                             <div className="vote-hint">
                               {discussionStarted ? "Click to view details" : "Hover & click to vote"}
                             </div>
@@ -325,16 +609,94 @@ const Session: React.FC = () => {
                   ) : (
                     <p>No ideas have been submitted yet.</p>
                   )}
+                  {currentSession.ideas.length > 1 && (
+                    <button onClick={handleClusterIdeas}>Group Similar Ideas</button>
+                  )}
+                  {currentSession.clustering && (
+                    <div className="idea-clusters">
+                      <h4>Similar Ideas</h4>
+                      {currentSession.clustering.clusters.map((cluster, idx) => (
+                        <div key={idx} className="idea-cluster">
+                          <strong>{cluster.label}</strong> ({cluster.ideaIds.length})
+                          <ul>
+                            {cluster.ideaIds.map(ideaId => (
+                              <li key={ideaId}>{ideaContent(ideaId)}</li>
+                            ))}
+                          </ul>
+                        </div>
+                      ))}
+                    </div>
+                  )}
                 </div>
               )}
               <div className="aggregation-section">
                 {isAggregating && (
                   <div className="aggregating-message">
-                    <p>Aggregating ideas... This may take a moment.</p>
+                    <p>
+                      {aggregationJob?.state === 'queued'
+                        ? 'Waiting for other aggregations to finish...'
+                        : 'Aggregating ideas... This may take a moment.'}
+                    </p>
+                    {aggregationStage && (
+                      <p className="aggregation-stage">
+                        {aggregationStage.stage === 'process'
+                          ? 'Processed'
+                          : aggregationStage.stage === 'map'
+                          ? 'Summarized'
+                          : `Merge round ${aggregationStage.level}:`}{' '}
+                        {aggregationStage.completed} of {aggregationStage.total}{' '}
+                        {aggregationStage.stage === 'process' ? 'ideas' : 'batches'}
+                      </p>
+                    )}
+                    {streamedText && <pre className="aggregation-stream">{streamedText}</pre>}
+                    <button onClick={handleCancelAggregation} className="cancel-aggregation">
+                      Cancel
+                    </button>
                   </div>
                 )}
-                {aggregatedResult && <AggregationDisplay content={aggregatedResult} />}
-                {aggregatedResult && !discussionStarted && (
+                {shownAggregation && (
+                  <AggregationDisplay
+                    aggregation={shownAggregation}
+                    ideas={currentSession?.ideas ?? []}
+                    guidingQuestions={currentSession?.guidingQuestions}
+                    onAcceptSuggestion={handleAcceptSuggestion}
+                  />
+                )}
+                {aggregationHistory.length > 1 && (
+                  <AggregationHistoryDisplay
+                    history={aggregationHistory}
+                    diff={aggregationDiff}
+                    ideas={currentSession?.ideas ?? []}
+                    onCompare={handleCompareAggregations}
+                  />
+                )}
+                <div className="usage-summary">
+                  <p>
+                    AI cost: ${(usage?.cost ?? 0).toFixed(4)}
+                    {currentSession?.budget ? ` of $${currentSession.budget.toFixed(2)} budget` : ''}
+                    {usage && ` (${usage.promptTokens + usage.completionTokens} tokens)`}
+                  </p>
+                  <input
+                    type="number"
+                    min="0"
+                    step="0.01"
+                    placeholder="Budget in USD (0 for none)"
+                    value={budgetInput}
+                    onChange={e => setBudgetInput(e.target.value)}
+                  />
+                  <button onClick={handleSetBudget}>Set Budget</button>
+                </div>
+                {currentSession?.phase === 'collect' && currentSession.ideas.length > 0 && (
+                  <button onClick={handleCloseCollection} className="start-discussion">
+                    Close Idea Collection
+                  </button>
+                )}
+                {!isAggregating && currentSession && currentSession.phase !== 'closed' && currentSession.ideas.length > 0 && (
+                  <button onClick={handleAggregateIdeas} className="start-discussion">
+                    Aggregate Ideas
+                  </button>
+                )}
+                {shownAggregation && currentSession?.phase === 'rate' && (
                   <button onClick={handleStartDiscussion} className="start-discussion">
                     Start Group Discussion
                   </button>
@@ -375,12 +737,18 @@ const Session: React.FC = () => {
                   <div className="chat-panel">
                     <div className="chat-messages">
                       {chatMessages
-                        .filter(msg => msg.type === 'session_message')
-                        .map((msg, idx) => (
-                          <div key={idx} className="chat-message">
-                            <strong>{msg.username || 'Anonymous'}:</strong> {msg.data}
-                          </div>
-                        ))}
+                        .filter(msg => msg.type === 'session_message' || msg.type === 'error')
+                        .map((msg, idx) =>
+                          msg.type === 'error' ? (
+                            <div key={idx} className="chat-message chat-error">
+                              {msg.data}
+                            </div>
+                          ) : (
+                            <div key={idx} className="chat-message">
+                              <strong>{msg.username || 'Anonymous'}:</strong> {msg.data}
+                            </div>
+                          )
+                        )}
                     </div>
                     <div className="chat-input">
                       <input
@@ -6,6 +6,14 @@ export interface MediaUploadResult {
   filename: string;
 }
 
+// Prompt templates and models a session can be created with
+export interface PromptOptions {
+  templates: { name: string; version: string }[];
+  defaultTemplate: string;
+  models: string[];
+  defaultModel: string;
+}
+
 export class MediaService {
   private apiUrl: string = 'https://bhh-brainstorming-production-d38d.up.railway.app';
   
@@ -36,32 +44,36 @@ export class MediaService {
     }
   }
   
+  /**
+   * Fetch the prompt templates and models sessions can use
+   * @returns Promise with the available options and the server's defaults
+   */
+  async getPromptOptions(): Promise<PromptOptions> {
+    const response = await fetch(`${this.apiUrl}/api/prompts`);
+    if (!response.ok) {
+      throw new Error(`Loading prompt options failed: ${response.statusText}`);
+    }
+    return (await response.json()) as PromptOptions;
+  }
+
   /**
    * Submit an idea with media attachment to a session
    * @param sessionId The session ID
    * @param content Text content of the idea
    * @param file Optional media file to attach
+   * @param guidingQuestion Optional number of the guiding question the idea answers
    */
-  async submitIdeaWithMedia(sessionId: string, content: string, file?: File): Promise<void> {
+  async submitIdeaWithMedia(sessionId: string, content: string, file?: File, guidingQuestion?: number): Promise<void> {
     try {
       // If there's a file, upload it first
       if (file) {
         const uploadResult = await this.uploadMedia(file);
         
         // Then submit the idea with the media URL
-        websocketService.sendMessage({
-          type: 'idea_submission',
-          sessionId: sessionId,
-          username: websocketService.getUsername(),
-          data: { 
-            content, 
-            mediaType: uploadResult.mediaType,
-            mediaURL: uploadResult.url 
-          },
-        });
+        websocketService.submitIdea(sessionId, content, uploadResult.mediaType, uploadResult.url, guidingQuestion).catch(() => {});
       } else {
         // Just submit the text content
-        websocketService.submitIdea(sessionId, content, 'text');
+        websocketService.submitIdea(sessionId, content, 'text', undefined, guidingQuestion).catch(() => {});
       }
     } catch (error) {
       console.error('Error submitting idea with media:', error);
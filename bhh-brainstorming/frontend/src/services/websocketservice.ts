@@ -11,6 +11,13 @@ export interface Idea {
   mediaURL?: string;
   submittedBy: User;
   ratings: IdeaRating[];
+  scores?: IdeaScores;
+  transcript?: string;
+  description?: string;
+  // Number of the guiding question the idea answers, from 1
+  guidingQuestion?: number;
+  // Set on ideas shown before the server has acknowledged them
+  pending?: boolean;
 }
 
 export interface IdeaRating {
@@ -21,6 +28,128 @@ export interface IdeaRating {
   comment?: string;
 }
 
+export interface ScoreStats {
+  mean: number;
+  median: number;
+  variance: number;
+}
+
+export interface IdeaScores {
+  count: number;
+  novelty: ScoreStats;
+  feasibility: ScoreStats;
+  usefulness: ScoreStats;
+}
+
+export interface Theme {
+  title: string;
+  summary: string;
+  ideaIds: string[];
+  pros: string[];
+  cons: string[];
+}
+
+export interface Aggregation {
+  id?: string;
+  summary: string;
+  themes: Theme[];
+  openQuestions: string[];
+  actionItems: string[];
+  model?: string;
+  promptTemplate?: string;
+  promptVersion?: string;
+  createdAt: string;
+  // Ideas the aggregation was built from
+  ideaIds?: string[];
+  // Ideas that could not be processed and are missing from the summary
+  failedIdeas?: { ideaId: string; error: string }[];
+  // One section per guiding question, then question 0 for unassigned ideas
+  sections?: QuestionSection[];
+  // Guiding questions the model suggests for untagged ideas
+  suggestions?: { ideaId: string; question: number }[];
+}
+
+export interface QuestionSection {
+  question: number;
+  summary: string;
+  ideaIds?: string[];
+}
+
+// Progress of an aggregation, sent as each idea, batch or merge finishes
+export interface AggregationStage {
+  stage: 'process' | 'map' | 'reduce';
+  level?: number;
+  completed: number;
+  total: number;
+}
+
+export interface ThemeChange {
+  title: string;
+  previousTitle?: string;
+  summaryChanged: boolean;
+  addedIdeaIds: string[];
+  removedIdeaIds: string[];
+  addedPros: string[];
+  removedPros: string[];
+  addedCons: string[];
+  removedCons: string[];
+}
+
+// What changed between two aggregations of a session
+export interface AggregationDiff {
+  from: string;
+  to: string;
+  addedThemes: Theme[];
+  removedThemes: Theme[];
+  changedThemes: ThemeChange[];
+  addedIdeaIds: string[];
+  removedIdeaIds: string[];
+  addedOpenQuestions: string[];
+  removedOpenQuestions: string[];
+  addedActionItems: string[];
+  removedActionItems: string[];
+  summaryChanged: boolean;
+}
+
+export type JobState = 'queued' | 'running' | 'done' | 'failed' | 'cancelled';
+
+// Status of a session's latest aggregation run
+export interface AggregationJob {
+  id: string;
+  state: JobState;
+  requestedBy: string;
+  cancelledBy?: string;
+  stage?: AggregationStage;
+  error?: string;
+  createdAt: string;
+  updatedAt: string;
+}
+
+export interface OperationUsage {
+  operation: 'media' | 'aggregation' | 'embedding' | 'nudge';
+  model: string;
+  calls: number;
+  promptTokens: number;
+  completionTokens: number;
+  cost: number;
+  // False when the model has no price, so its cost is not counted
+  priced: boolean;
+}
+
+// Token usage and cost of a session's AI calls, in US dollars
+export interface UsageReport {
+  sessionId: string;
+  operations: OperationUsage[];
+  promptTokens: number;
+  completionTokens: number;
+  cost: number;
+  budget: number;
+}
+
+export type SessionPhase = 'collect' | 'rate' | 'discuss' | 'closed';
+
+export type SessionRole = 'facilitator' | 'participant' | 'observer';
+
 export interface ISession {
   id: string;
   name: string;
@@ -29,6 +158,49 @@ export interface ISession {
   creator: User;
   users: Record<string, User>;
   ideas: Idea[];
+  phase: SessionPhase;
+  roles: Record<string, SessionRole>;
+  aggregation?: Aggregation;
+  // Prompt template and model chosen at creation; absent for the defaults
+  promptTemplate?: string;
+  model?: string;
+  // AI budget in US dollars; absent when the session has none
+  budget?: number;
+  // Latest grouping of similar ideas; absent until ideas are clustered
+  clustering?: IdeaClustering;
+  // Set when a facilitator turned off AI prompts for stuck participants
+  nudgesDisabled?: boolean;
+  // Seq of the latest event applied to the session
+  seq: number;
+  // IDs of users kicked from the session, who cannot join it again
+  banned?: Record<string, boolean>;
+}
+
+// An AI suggestion for a participant who has run out of ideas
+export interface Nudge {
+  technique: string;
+  text: string;
+  // The idea it builds on, if any
+  ideaId?: string;
+  // Number of the guiding question it targets, from 1
+  guidingQuestion?: number;
+}
+
+export interface IdeaCluster {
+  label: string;
+  ideaIds: string[];
+}
+
+export interface IdeaClustering {
+  clusters: IdeaCluster[];
+  model: string;
+  createdAt: string;
+}
+
+// Sent only to the submitter of an idea that resembles existing ones
+export interface DuplicateWarning {
+  ideaId: string;
+  duplicates: { ideaId: string; similarity: number }[];
 }
 
 export interface Message {
@@ -36,13 +208,81 @@ export interface Message {
   sessionId?: string;
   userId?: string;
   username?: string;
+  // Chosen by the client; replies to the message echo it
+  requestId?: string;
+  // Numbers the session events the server publishes, from 1
+  seq?: number;
   data?: any;
 }
 
+// Payload of the 'connected' message every connection starts with.
+export interface ConnectedData {
+  userId: string;
+  resumeToken: string;
+}
+
+// Payload of a 'resumed' reply. With resync set, the missed messages were
+// no longer kept and a 'session_joined' with the whole session came instead.
+export interface ResumedData {
+  userId: string;
+  seq: number;
+  replayed: number;
+  resync?: boolean;
+}
+
+// Payload of an 'error' reply. The code is one of the server's error codes,
+// such as 'invalid_data' or 'forbidden'.
+export interface ErrorData {
+  code: string;
+  message: string;
+  messageType?: string;
+}
+
+// Payload of an 'ack' reply, with the IDs of whatever the message created.
+export interface AckData {
+  messageType: string;
+  sessionId?: string;
+  ideaId?: string;
+  jobId?: string;
+}
+
+// How long to wait for an ack or error before sending a message again, and
+// how often to send it. Retries reuse the requestId, so the server carries
+// a message out only once.
+const ackTimeoutMs = 5000;
+const maxAttempts = 3;
+
+// Delays before reconnecting a dropped socket, doubling up to the maximum.
+const reconnectDelayMs = 1000;
+const maxReconnectDelayMs = 30000;
+
+interface PendingRequest {
+  message: Message;
+  attempts: number;
+  timer?: ReturnType<typeof setTimeout>;
+  resolve: (ack: AckData) => void;
+  reject: (error: ErrorData) => void;
+}
+
+// ID of the placeholder shown for an idea until the server has it.
+export const pendingIdeaId = (requestId: string) => `pending-${requestId}`;
+
 export class WebSocketService {
   private socket: WebSocket | null = null;
   private username: string = '';
-  private listeners: { [key: string]: ((data: any) => void)[] } = {};
+  private listeners: { [key: string]: ((data: any, message: Message) => void)[] } = {};
+  private pending: { [requestId: string]: PendingRequest } = {};
+  private requestCount = 0;
+  // Lets a new connection take over this client's user after a drop
+  private resumeToken = '';
+  // Token of the current connection, used when resuming fails
+  private connectionToken = '';
+  // The session this client is in and the latest seq seen there
+  private sessionId = '';
+  private lastSeq = 0;
+  private reconnectTimer?: ReturnType<typeof setTimeout>;
+  private reconnectDelay = reconnectDelayMs;
+  private closing = false;
 
   getUsername(): string {
     return this.username;
@@ -50,55 +290,135 @@ export class WebSocketService {
 
   connect(username: string): Promise<void> {
     this.username = username;
-    return new Promise((resolve, reject) => {
-      this.socket = new WebSocket('wss://bhh-brainstorming-production-d38d.up.railway.app/ws');
-      this.socket.onopen = () => {
-        console.log('WebSocket connected');
-        this.listSessions();
-        resolve();
-      };
-      this.socket.onclose = () => {
-        console.log('WebSocket disconnected');
+    this.closing = false;
+    return new Promise((resolve, reject) => this.open(resolve, reject));
+  }
+
+  // Opens the socket. A socket that drops is opened again with growing
+  // delays, and the new connection resumes where the old one stopped.
+  private open(resolve?: () => void, reject?: (error: Event) => void): void {
+    const socket = new WebSocket('wss://bhh-brainstorming-production-d38d.up.railway.app/ws');
+    this.socket = socket;
+    socket.onopen = () => {
+      console.log('WebSocket connected');
+      this.reconnectDelay = reconnectDelayMs;
+      if (this.resumeToken) {
+        this.resume();
+      }
+      this.listSessions();
+      resolve?.();
+    };
+    socket.onclose = () => {
+      console.log('WebSocket disconnected');
+      if (this.socket === socket) {
         this.socket = null;
-      };
-      this.socket.onerror = (error) => {
-        console.error('WebSocket error:', error);
-        reject(error);
-      };
-      this.socket.onmessage = (event) => {
-        const message: Message = JSON.parse(event.data);
-        console.log('Received message:', message);
-        if (message.type && this.listeners[message.type]) {
-          this.listeners[message.type].forEach((callback) => callback(message.data));
+      }
+      if (!this.closing) {
+        this.reconnectTimer = setTimeout(() => this.open(), this.reconnectDelay);
+        this.reconnectDelay = Math.min(this.reconnectDelay * 2, maxReconnectDelayMs);
+      }
+    };
+    socket.onerror = (error) => {
+      console.error('WebSocket error:', error);
+      reject?.(error);
+    };
+    socket.onmessage = (event) => {
+      const message: Message = JSON.parse(event.data);
+      console.log('Received message:', message);
+      if (message.seq) {
+        // Already seen before the connection dropped
+        if (message.seq <= this.lastSeq) {
+          return;
         }
-      };
+        this.lastSeq = message.seq;
+      }
+      this.track(message);
+      if ((message.type === 'ack' || message.type === 'error') && message.requestId) {
+        this.settle(message);
+      }
+      this.emit(message.type, message.data, message);
+    };
+  }
+
+  // Follows the identity and session the server reports.
+  private track(message: Message): void {
+    switch (message.type) {
+      case 'connected':
+        this.connectionToken = message.data.resumeToken;
+        if (!this.resumeToken) {
+          this.resumeToken = this.connectionToken;
+        }
+        break;
+      case 'session_created':
+      case 'session_joined':
+        this.sessionId = message.data.id;
+        this.lastSeq = message.data.seq || 0;
+        break;
+      case 'kicked':
+        this.sessionId = '';
+        this.lastSeq = 0;
+        break;
+      case 'resumed':
+        // Messages sent while the socket was down may not have arrived
+        Object.values(this.pending).forEach((entry) => {
+          if (entry.message.type !== 'resume') {
+            clearTimeout(entry.timer);
+            entry.attempts = 0;
+            this.attempt(entry);
+          }
+        });
+        break;
+    }
+  }
+
+  // Takes over the user of the dropped connection and asks for the session
+  // messages missed meanwhile. When the server no longer knows the token or
+  // the user left the session, this connection's own user joins it anew.
+  private resume(): void {
+    const sessionId = this.sessionId;
+    this.request({
+      type: 'resume',
+      sessionId: sessionId || undefined,
+      data: { token: this.resumeToken, lastSeq: this.lastSeq },
+    }).catch(() => {
+      this.resumeToken = this.connectionToken;
+      this.lastSeq = 0;
+      if (sessionId) {
+        this.joinSession(sessionId);
+      }
     });
   }
 
   disconnect(): void {
+    this.closing = true;
+    clearTimeout(this.reconnectTimer);
     if (this.socket) {
       this.socket.close();
       this.socket = null;
     }
   }
 
-  createSession(name: string, guidingQuestions: string[]): void {
+  // Without a template or model the server's defaults are used.
+  createSession(name: string, guidingQuestions: string[], promptTemplate?: string, model?: string): void {
     this.sendMessage({
       type: 'create_session',
       username: this.username,
-      data: { name, guidingQuestions },
+      data: { name, guidingQuestions, promptTemplate, model },
     });
   }
 
-  joinSession(sessionId: string): void {
+  joinSession(sessionId: string, role?: 'observer'): void {
     this.sendMessage({
       type: 'join_session',
       sessionId: sessionId,
       username: this.username,
+      data: role ? { role } : undefined,
     });
   }
 
   leaveSession(): void {
+    this.sessionId = '';
+    this.lastSeq = 0;
     this.sendMessage({ type: 'leave_session' });
   }
 
@@ -106,7 +426,7 @@ export class WebSocketService {
     this.sendMessage({ type: 'list_sessions' });
   }
 
-  sendSessionMessage(sessionId: string, data: any): void {
+  sendSessionMessage(sessionId: string, data: string): void {
     this.sendMessage({
       type: 'session_message',
       sessionId: sessionId,
@@ -114,12 +434,61 @@ export class WebSocketService {
     });
   }
 
-  submitIdea(sessionId: string, content: string, mediaType: string = 'text', mediaURL?: string): void {
-    this.sendMessage({
+  // The idea is shown at once as pending ('idea_pending'), and withdrawn
+  // again ('idea_settled') once the server has answered.
+  submitIdea(sessionId: string, content: string, mediaType: string = 'text', mediaURL?: string, guidingQuestion?: number): Promise<AckData> {
+    const requestId = this.nextRequestId();
+    this.emit('idea_pending', {
+      id: pendingIdeaId(requestId),
+      content,
+      mediaType,
+      mediaURL,
+      guidingQuestion,
+      submittedBy: { id: '', username: this.username },
+      ratings: [],
+      pending: true,
+    });
+    const ack = this.request({
       type: 'idea_submission',
       sessionId: sessionId,
       username: this.username,
-      data: { content, mediaType, mediaURL },
+      requestId,
+      data: { content, mediaType, mediaURL, guidingQuestion },
+    });
+    const settled = () => this.emit('idea_settled', { requestId });
+    ack.then(settled, settled);
+    return ack;
+  }
+
+  // Question 0 removes the idea's tag.
+  tagIdea(sessionId: string, ideaId: string, guidingQuestion: number): void {
+    this.sendMessage({
+      type: 'tag_idea',
+      sessionId: sessionId,
+      data: { ideaId, guidingQuestion },
+    });
+  }
+
+  // The server answers with 'nudges' sent to this client only.
+  requestPrompt(sessionId: string): void {
+    this.sendMessage({
+      type: 'request_prompt',
+      sessionId: sessionId,
+    });
+  }
+
+  setNudges(sessionId: string, enabled: boolean): void {
+    this.sendMessage({
+      type: 'set_nudges',
+      sessionId: sessionId,
+      data: { enabled },
+    });
+  }
+
+  clusterIdeas(sessionId: string): void {
+    this.sendMessage({
+      type: 'cluster_ideas',
+      sessionId: sessionId,
     });
   }
 
@@ -130,6 +499,53 @@ export class WebSocketService {
     });
   }
 
+  cancelAggregation(sessionId: string, jobId?: string): void {
+    this.sendMessage({
+      type: 'cancel_aggregation',
+      sessionId: sessionId,
+      data: jobId ? { jobId } : undefined,
+    });
+  }
+
+  requestAggregationStatus(sessionId: string): void {
+    this.sendMessage({
+      type: 'aggregation_status',
+      sessionId: sessionId,
+    });
+  }
+
+  requestAggregationHistory(sessionId: string): void {
+    this.sendMessage({
+      type: 'aggregation_history',
+      sessionId: sessionId,
+    });
+  }
+
+  // Without IDs the server compares the latest two aggregations.
+  compareAggregations(sessionId: string, from?: string, to?: string): void {
+    this.sendMessage({
+      type: 'aggregation_diff',
+      sessionId: sessionId,
+      data: from && to ? { from, to } : undefined,
+    });
+  }
+
+  // A budget of 0 removes the session's cap.
+  setBudget(sessionId: string, budget: number): void {
+    this.sendMessage({
+      type: 'set_budget',
+      sessionId: sessionId,
+      data: { budget },
+    });
+  }
+
+  requestUsageReport(sessionId: string): void {
+    this.sendMessage({
+      type: 'usage_report',
+      sessionId: sessionId,
+    });
+  }
+
   sendIdeaRating(sessionId: string, ideaId: string, rating: { novelty: number; feasibility: number; usefulness: number; comment?: string }): void {
     this.sendMessage({
       type: 'idea_rating',
@@ -138,29 +554,107 @@ export class WebSocketService {
     });
   }
 
+  changePhase(sessionId: string, phase: SessionPhase): void {
+    this.sendMessage({
+      type: 'change_phase',
+      sessionId: sessionId,
+      data: { phase },
+    });
+  }
+
   startDiscussion(sessionId: string): void {
+    this.changePhase(sessionId, 'discuss');
+  }
+
+  kickUser(sessionId: string, userId: string): void {
+    this.sendMessage({
+      type: 'kick_user',
+      sessionId: sessionId,
+      data: { userId },
+    });
+  }
+
+  promoteUser(sessionId: string, userId: string): void {
     this.sendMessage({
-      type: 'start_discussion',
+      type: 'promote_user',
       sessionId: sessionId,
+      data: { userId },
     });
   }
 
+  // Failures reach the 'error' listeners; use request to wait for the outcome.
   sendMessage(message: Message): void {
+    this.request(message).catch(() => {});
+  }
+
+  // Sends a message and resolves with its ack, or rejects with the error
+  // the server answered. Unanswered messages are sent again.
+  request(message: Message): Promise<AckData> {
+    const outgoing = { ...message, requestId: message.requestId || this.nextRequestId() };
+    return new Promise((resolve, reject) => {
+      const entry: PendingRequest = { message: outgoing, attempts: 0, resolve, reject };
+      this.pending[outgoing.requestId] = entry;
+      this.attempt(entry);
+    });
+  }
+
+  private attempt(entry: PendingRequest): void {
+    entry.attempts++;
     if (this.socket && this.socket.readyState === WebSocket.OPEN) {
-      this.socket.send(JSON.stringify(message));
+      this.socket.send(JSON.stringify(entry.message));
     } else {
       console.error('WebSocket is not connected');
     }
+    entry.timer = setTimeout(() => {
+      if (entry.attempts < maxAttempts) {
+        this.attempt(entry);
+        return;
+      }
+      const requestId = entry.message.requestId!;
+      delete this.pending[requestId];
+      const error: ErrorData = {
+        code: 'timeout',
+        message: 'The server did not answer',
+        messageType: entry.message.type,
+      };
+      entry.reject(error);
+      this.emit('error', error, { type: 'error', requestId, data: error });
+    }, ackTimeoutMs);
+  }
+
+  private settle(message: Message): void {
+    const entry = this.pending[message.requestId!];
+    if (!entry) {
+      return;
+    }
+    clearTimeout(entry.timer);
+    delete this.pending[message.requestId!];
+    if (message.type === 'ack') {
+      entry.resolve(message.data);
+    } else {
+      entry.reject(message.data);
+    }
+  }
+
+  private nextRequestId(): string {
+    this.requestCount++;
+    return `${Date.now().toString(36)}-${this.requestCount}-${Math.random().toString(36).slice(2, 8)}`;
+  }
+
+  private emit(type: string, data: any, message?: Message): void {
+    if (this.listeners[type]) {
+      this.listeners[type].forEach((callback) => callback(data, message || { type, data }));
+    }
   }
 
-  on(type: string, callback: (data: any) => void): void {
+  on(type: string, callback: (data: any, message: Message) => void): void {
     if (!this.listeners[type]) {
       this.listeners[type] = [];
     }
     this.listeners[type].push(callback);
   }
 
-  off(type: string, callback: (data: any) => void): void {
+  off(type: string, callback: (data: any, message: Message) => void): void {
     if (this.listeners[type]) {
       this.listeners[type] = this.listeners[type].filter((cb) => cb !== callback);
     }